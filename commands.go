@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// defaultEventFormat is the event output for get when no outputs are selected.
+const defaultEventFormat = "EventID,EventType,OriginTime,Latitude,Longitude,Depth,Magnitude,MagnitudeType,Description"
+
+// command is a qsearch subcommand.  run is called with the arguments after the subcommand name.
+type command struct {
+	about string
+	run   func(args []string)
+}
+
+// commands are the qsearch subcommands.  Without a subcommand qsearch accepts all the search and output flags.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"events": listCommand("events", "Search for quakes and output event information.", eventFormat, false,
+			func(o *outputs) (*string, *string) {
+				o.event = true
+				return &o.eventF, &o.eventOut
+			}),
+		"picks": listCommand("picks", "Search for quakes and output Pick information.", pickFormat, true,
+			func(o *outputs) (*string, *string) {
+				o.picks = true
+				return &o.picksF, &o.picksOut
+			}),
+		"arrivals": listCommand("arrivals", "Search for quakes and output Arrival information for the PreferredOrigin.", arrivalFormat, true,
+			func(o *outputs) (*string, *string) {
+				o.poArrivals = true
+				return &o.arrivalsF, &o.arrivalsOut
+			}),
+		"get": {
+			about: "Output information for the events given as arguments.  Without any output flags the event information is output.",
+			run:   getCommand,
+		},
+		"export": {
+			about: "Search for quakes and write the selected outputs to files or a database.",
+			run:   exportCommand,
+		},
+		"serve": {
+			about: "Serve the events, picks, and arrivals searches as an HTTP API.",
+			run:   serveCommand,
+		},
+		"sync": {
+			about: "Keep a local mirror of the quakes and their details up to date.  Only quakes modified since the last sync are fetched.",
+			run:   syncCommand,
+		},
+		"help": {
+			about: "Print the help for a command.",
+			run:   helpCommand,
+		},
+	}
+}
+
+// listCommand returns a command that searches for quakes and outputs one kind of information.
+// selected enables the output in o and returns its format and output file settings.  If filters is
+// true the Pick and agency filter flags are added.
+func listCommand(name, about string, format map[string]string, filters bool, selected func(o *outputs) (*string, *string)) command {
+	return command{
+		about: about,
+		run: func(args []string) {
+			fs := flag.NewFlagSet(name, flag.ExitOnError)
+
+			var s search
+			var o outputs
+			var fl followFlags
+
+			f, out := selected(&o)
+
+			s.addFlags(fs)
+			fs.StringVar(f, "format", "",
+				"output format selector.  Any combination and any order of the following values, separated by ',': "+formatString(format))
+			fs.StringVar(out, "out", "", "write the output to this file instead of stdout.")
+			fs.BoolVar(&o.header, "header", false, "output a header line naming the columns.")
+			fs.StringVar(&o.parquetDir, "parquet", "", "write the output to "+name+".parquet in this directory instead of CSV.")
+			if filters {
+				o.addFilterFlags(fs)
+			}
+			o.addSortFlags(fs)
+			fl.addFlags(fs)
+			fs.Usage = usage(fs, name+" [flags]", about)
+
+			if a := parseFlags(fs, args); len(a) > 0 {
+				log.Fatalf("unexpected arguments for %s: %v", name, a)
+			}
+
+			if *f == "" {
+				log.Fatal("--format must be provided.")
+			}
+
+			if err := fl.check(fs, name, &o); err != nil {
+				log.Fatal(err)
+			}
+
+			if fl.follow || fl.state != "" {
+				fl.run(&s, fs, &o)
+				return
+			}
+
+			query, err := s.query(fs, true)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			run(query, &o)
+		},
+	}
+}
+
+// getCommand outputs information for the events given as the arguments.  The output flags are the
+// same as without a subcommand.
+func getCommand(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+
+	var o outputs
+
+	o.addFlags(fs)
+	fs.Usage = usage(fs, "get [flags] <eventid>...", commands["get"].about)
+
+	a := parseFlags(fs, args)
+	if len(a) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	query, err := eventQuery(a)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	o.validate()
+
+	if !o.selected() {
+		o.event = true
+		if o.eventF == "" {
+			o.eventF = defaultEventFormat
+		}
+	}
+
+	run(query, &o)
+}
+
+// exportCommand searches for quakes and writes the selected outputs.  At least one of the file or
+// database outputs must be used.
+func exportCommand(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+
+	var s search
+	var o outputs
+
+	s.addFlags(fs)
+	o.addFlags(fs)
+	fs.Usage = usage(fs, "export [flags]", commands["export"].about)
+
+	if a := parseFlags(fs, args); len(a) > 0 {
+		log.Fatalf("unexpected arguments for export: %v", a)
+	}
+
+	if o.outDir == "" && o.parquetDir == "" && o.sqliteDB == "" && o.geoJSON == "" && o.hypoDD == "" {
+		log.Fatal("export needs at least one of --out-dir, --parquet, --sqlite, --geojson, or --hypodd.")
+	}
+
+	query, err := s.query(fs, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	run(query, &o)
+}
+
+// helpCommand prints the help for the command given as the argument or for qsearch.
+func helpCommand(args []string) {
+	if len(args) == 1 && args[0] != "help" {
+		if c, ok := commands[args[0]]; ok {
+			c.run([]string{"-h"})
+			return
+		}
+	}
+
+	var s search
+	var o outputs
+	var c configFlags
+
+	s.addFlags(flag.CommandLine)
+	o.addFlags(flag.CommandLine)
+	c.addFlags(flag.CommandLine)
+
+	legacyUsage()
+}
+
+// legacyUsage prints the commands and the flags that can be used without a subcommand.
+func legacyUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n  qsearch <command> [flags]\n\nCommands:\n")
+
+	var names []string
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", n, commands[n].about)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nUse qsearch help <command> for the flags for a command.  ")
+	fmt.Fprintf(os.Stderr, "Without a command qsearch accepts all the search and output flags:\n\n  qsearch [flags]\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// usage returns a usage function for a command.
+func usage(fs *flag.FlagSet, use, about string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  qsearch %s\n\n%s\n\nFlags:\n", use, about)
+		fs.PrintDefaults()
+	}
+}
+
+// parseArgs parses the flags in args for fs.  Flags can come before or after the positional
+// arguments, which are returned.
+func parseArgs(fs *flag.FlagSet, args []string) (a []string) {
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return a
+		}
+		a = append(a, args[0])
+		args = args[1:]
+	}
+}
+
+// selected returns true if any output has been selected.
+func (o *outputs) selected() bool {
+	return o.event || o.picks || o.poArrivals || o.pOrigin || o.origins || o.magnitudes || o.stationMagnitudes ||
+		o.amplitudes || o.focalMechanisms || o.sqliteDB != "" || o.geoJSON != "" || o.hypoDD != "" || o.tmpl != "" ||
+		o.tmplFile != ""
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/GeoNet/qsearch/config"
+	"github.com/GeoNet/qsearch/fdsnevent"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// configFlags holds the configuration file, profile, cache, backend, and logging flags.
+type configFlags struct {
+	file      string
+	profile   string
+	cache     string
+	backend   string
+	quiet     bool
+	verbose   bool
+	logFormat string
+}
+
+// backend is the service that is searched for quakes; wfs, fdsn, or fdsn-text.
+var backend = "wfs"
+
+// eventidFlags and criteriaFlags are the search flags that can't be combined.  Flags from one group are
+// not set from the configuration file if a flag from the other group is used on the command line.
+// --fdsn can set flags from either group so it is in both.
+var (
+	eventidFlags  = []string{"eventid", "eventid-file", "fdsn"}
+	criteriaFlags = []string{"start", "end", "min-used-phase-count", "min-magnitude", "max-magnitude", "min-depth", "max-depth",
+		"bbox", "latitude", "longitude", "min-radius", "max-radius", "fdsn"}
+)
+
+// addFlags adds the configuration flags to fs.
+func (c *configFlags) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.file, "config", defaultConfigFile(),
+		"read endpoints, default flags, and profiles from this configuration file.  It is not an error if the default file does not exist.")
+	fs.StringVar(&c.profile, "profile", "", "use the flags from this profile in the configuration file e.g., --profile wellington-m4.")
+	fs.StringVar(&c.cache, "cache", "", "cache quake details in this directory.  Cached details are refetched if the quake has been modified.")
+	fs.BoolVar(&c.quiet, "quiet", false, "only log warnings and errors.")
+	fs.BoolVar(&c.verbose, "verbose", false, "also log each URL that is fetched and each quake that is downloaded.")
+	fs.StringVar(&c.logFormat, "log-format", "text", "the format for logging to stderr; text or json for one JSON object per line.")
+	fs.StringVar(&c.backend, "backend", "wfs", "search for quakes with this service; wfs, fdsn for an FDSN event service with QuakeML, or fdsn-text for an FDSN event service with the text format.")
+}
+
+// defaultConfigFile returns the path of qsearch.toml in the user's configuration directory.
+func defaultConfigFile() string {
+	d := os.Getenv("XDG_CONFIG_HOME")
+	if d == "" {
+		h, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		d = filepath.Join(h, ".config")
+	}
+	return filepath.Join(d, "qsearch.toml")
+}
+
+// parseFlags parses args for fs and then sets the flags that were not on the command line from the
+// [defaults] table and the profile in the configuration file.  Flags can come before or after the
+// positional arguments, which are returned.
+func parseFlags(fs *flag.FlagSet, args []string) (a []string) {
+	var c configFlags
+	c.addFlags(fs)
+
+	a = parseArgs(fs, args)
+
+	if err := c.apply(fs); err != nil {
+		log.Fatal(err)
+	}
+
+	return a
+}
+
+// apply reads the configuration file and sets the endpoints, the cache, and the flags in fs that were
+// not set on the command line.  Profile values take precedence over the defaults.
+func (c *configFlags) apply(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	cfg := config.Config{}
+
+	if c.file != "" {
+		var err error
+		cfg, err = config.ReadFile(c.file)
+		switch {
+		case os.IsNotExist(err) && !set["config"]:
+			cfg = config.Config{}
+		case err != nil:
+			return err
+		}
+	}
+
+	v := make(map[string]string)
+	for k, s := range cfg["defaults"] {
+		v[k] = s
+	}
+
+	if c.profile != "" {
+		p, ok := cfg.Profile(c.profile)
+		if !ok {
+			return fmt.Errorf("no profile %s in %s", c.profile, c.file)
+		}
+		for k, s := range p {
+			v[k] = s
+		}
+	}
+
+	skip := map[string]bool{"config": true, "profile": true}
+	if anySet(set, eventidFlags) {
+		for _, f := range criteriaFlags {
+			skip[f] = true
+		}
+	}
+	if anySet(set, criteriaFlags) {
+		for _, f := range eventidFlags {
+			skip[f] = true
+		}
+	}
+
+	for k, s := range v {
+		if set[k] || skip[k] {
+			continue
+		}
+		// Flags that this command doesn't have are ignored so that the defaults can be shared.
+		if fs.Lookup(k) == nil {
+			continue
+		}
+		if err := fs.Set(k, s); err != nil {
+			return fmt.Errorf("%s: %s: %v", c.file, k, err)
+		}
+	}
+
+	if u := cfg["endpoints"]["wfs"]; u != "" {
+		wfs.URL = u
+	}
+
+	if u := cfg["endpoints"]["seiscompml"]; u != "" {
+		seiscompml07.URL = u
+	}
+
+	if u := cfg["endpoints"]["fdsn"]; u != "" {
+		fdsnevent.URL = u
+	}
+
+	switch c.backend {
+	case "wfs", "fdsn":
+		fdsnevent.Format = "xml"
+	case "fdsn-text":
+		fdsnevent.Format = "text"
+	default:
+		return fmt.Errorf("invalid --backend %s", c.backend)
+	}
+
+	backend = c.backend
+
+	if err := setLogging(c.quiet, c.verbose, c.logFormat); err != nil {
+		return err
+	}
+
+	seiscompml07.CacheDir = expandHome(c.cache)
+
+	return nil
+}
+
+// anySet returns true if any of the flags are in set.
+func anySet(set map[string]bool, flags []string) bool {
+	for _, f := range flags {
+		if set[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// expandHome replaces a leading ~ in p with the user's home directory.
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+
+	return filepath.Join(h, p[1:])
+}
+
+// expireCache removes the cached quake details in dir that are older than the WFS modification
+// time for the quake so that they are fetched again.  The details are kept if the modification time
+// is not known e.g., for --backend fdsn-text.
+func expireCache(dir string, quakes []map[string]string) {
+	for _, q := range quakes {
+		f := filepath.Join(dir, q["EventID"]+".xml")
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+
+		m, err := time.Parse(time.RFC3339Nano, q["ModificationTime"])
+		if err != nil || fi.ModTime().After(m) {
+			continue
+		}
+
+		if err = os.Remove(f); err != nil {
+			warnf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package config reads qsearch configuration files.  These are a subset of TOML: comments,
+// [table] and [table.name] headers, and key = value pairs where the value is a basic or
+// literal string, a number, or a boolean.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Config is the tables in a configuration file.  Each table maps keys to values as
+// strings.  Keys before the first table header are in the table "".
+type Config map[string]map[string]string
+
+var (
+	tableRe = regexp.MustCompile(`^\[\s*([A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*)\s*\]$`)
+	keyRe   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Read reads a configuration from r.
+func Read(r io.Reader) (c Config, err error) {
+	c = Config{"": make(map[string]string)}
+	t := ""
+
+	s := bufio.NewScanner(r)
+
+	for n := 1; s.Scan(); n++ {
+		l := strings.TrimSpace(s.Text())
+
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(l, "[") {
+			if i := strings.Index(l, "#"); i > 0 {
+				l = strings.TrimSpace(l[:i])
+			}
+			m := tableRe.FindStringSubmatch(l)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: invalid table %s", n, l)
+			}
+			t = m[1]
+			if _, ok := c[t]; ok && t != "" {
+				return nil, fmt.Errorf("line %d: duplicate table %s", n, t)
+			}
+			c[t] = make(map[string]string)
+			continue
+		}
+
+		i := strings.Index(l, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+
+		k := strings.TrimSpace(l[:i])
+		if !keyRe.MatchString(k) {
+			return nil, fmt.Errorf("line %d: invalid key %s", n, k)
+		}
+
+		v, err := value(strings.TrimSpace(l[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", n, k, err)
+		}
+
+		if _, ok := c[t][k]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %s", n, k)
+		}
+		c[t][k] = v
+	}
+
+	return c, s.Err()
+}
+
+// ReadFile reads the configuration file name.
+func ReadFile(name string) (Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return c, nil
+}
+
+// Profile returns the table for the profile name e.g., [profiles.wellington-m4].
+func (c Config) Profile(name string) (p map[string]string, ok bool) {
+	p, ok = c["profiles."+name]
+	return p, ok
+}
+
+// value returns the value for v, which can be followed by a comment.
+func value(v string) (string, error) {
+	var s, rest string
+
+	switch {
+	case strings.HasPrefix(v, `"`):
+		i := 1
+		for ; i < len(v); i++ {
+			if v[i] == '\\' {
+				i++
+				continue
+			}
+			if v[i] == '"' {
+				break
+			}
+		}
+		if i >= len(v) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		var err error
+		if s, err = strconv.Unquote(v[:i+1]); err != nil {
+			return "", fmt.Errorf("invalid string %s", v[:i+1])
+		}
+		rest = v[i+1:]
+	case strings.HasPrefix(v, "'"):
+		i := strings.Index(v[1:], "'")
+		if i < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		s = v[1 : i+1]
+		rest = v[i+2:]
+	default:
+		if i := strings.Index(v, "#"); i >= 0 {
+			v = v[:i]
+		}
+		s = strings.TrimSpace(v)
+		if s == "true" || s == "false" {
+			return s, nil
+		}
+		if _, err := strconv.ParseFloat(strings.Replace(s, "_", "", -1), 64); err != nil {
+			return "", fmt.Errorf("invalid value %s", s)
+		}
+		return strings.Replace(s, "_", "", -1), nil
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %s after value", rest)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const example = `
+# qsearch configuration
+top = 1
+
+[endpoints]
+wfs = "http://example.org/ows?a=1&b=2" # comment
+seiscompml = 'http://example.org/sc3/'
+
+[defaults]
+header = true
+cache = "~/.cache/qsearch"
+
+[profiles.wellington-m4]
+bbox = "174,-41,175,-42"
+min-magnitude = 4.0
+min-used-phase-count = 1_000
+event-format = "EventID,\"Magnitude\""
+`
+
+func TestRead(t *testing.T) {
+	c, err := Read(strings.NewReader(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c[""]["top"] != "1" {
+		t.Error("top expected 1, got ", c[""]["top"])
+	}
+	if c["endpoints"]["wfs"] != "http://example.org/ows?a=1&b=2" {
+		t.Error("wfs incorrect, got ", c["endpoints"]["wfs"])
+	}
+	if c["endpoints"]["seiscompml"] != "http://example.org/sc3/" {
+		t.Error("seiscompml incorrect, got ", c["endpoints"]["seiscompml"])
+	}
+	if c["defaults"]["header"] != "true" {
+		t.Error("header expected true, got ", c["defaults"]["header"])
+	}
+
+	p, ok := c.Profile("wellington-m4")
+	if !ok {
+		t.Fatal("missing profile wellington-m4")
+	}
+	if p["bbox"] != "174,-41,175,-42" {
+		t.Error("bbox incorrect, got ", p["bbox"])
+	}
+	if p["min-magnitude"] != "4.0" {
+		t.Error("min-magnitude expected 4.0, got ", p["min-magnitude"])
+	}
+	if p["min-used-phase-count"] != "1000" {
+		t.Error("min-used-phase-count expected 1000, got ", p["min-used-phase-count"])
+	}
+	if p["event-format"] != `EventID,"Magnitude"` {
+		t.Error("event-format incorrect, got ", p["event-format"])
+	}
+
+	if _, ok := c.Profile("auckland"); ok {
+		t.Error("unexpected profile auckland")
+	}
+}
+
+func TestReadBad(t *testing.T) {
+	for _, s := range []string{
+		"[defaults",
+		"header",
+		"bad key = 1",
+		"header = yes",
+		`wfs = "http://example.org`,
+		`wfs = "a" b`,
+		"a = 1\na = 2",
+		"[defaults]\n[defaults]",
+	} {
+		if _, err := Read(strings.NewReader(s)); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
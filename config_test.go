@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpireCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cached := time.Date(2014, 7, 23, 7, 0, 0, 0, time.UTC)
+
+	for _, v := range []string{"old", "new", "unknown", "invalid"} {
+		f := filepath.Join(dir, v+".xml")
+		if err = ioutil.WriteFile(f, []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(f, cached, cached); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expireCache(dir, []map[string]string{
+		{"EventID": "old", "ModificationTime": "2014-07-23T07:10:00Z"},
+		{"EventID": "new", "ModificationTime": "2014-07-23T06:50:00.5Z"},
+		// Without a modification time the details are kept.
+		{"EventID": "unknown", "ModificationTime": ""},
+		{"EventID": "invalid", "ModificationTime": "2014-07-23"},
+		// Not in the cache.
+		{"EventID": "missing", "ModificationTime": "2014-07-23T07:10:00Z"},
+	})
+
+	for k, v := range map[string]bool{"old": false, "new": true, "unknown": true, "invalid": true} {
+		if _, err := os.Stat(filepath.Join(dir, k+".xml")); (err == nil) != v {
+			t.Errorf("%s expected cached %t, got %v", k, v, err)
+		}
+	}
+}
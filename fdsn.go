@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fdsnVersion is the version of the FDSN event web service that is served.
+const fdsnVersion = "1.2.0"
+
+// fdsnMaxDetails is the most quakes that quake details are fetched for in a QuakeML response.  Larger
+// responses are from the WFS only so that a catalogue-wide query does not fetch every quake's details.
+const fdsnMaxDetails = 100
+
+// fdsnFlags maps the FDSN event web service query parameters to the search flags.
+var fdsnFlags = map[string]string{
+	"starttime":    "start",
+	"start":        "start",
+	"endtime":      "end",
+	"end":          "end",
+	"minmagnitude": "min-magnitude",
+	"minmag":       "min-magnitude",
+	"maxmagnitude": "max-magnitude",
+	"maxmag":       "max-magnitude",
+	"mindepth":     "min-depth",
+	"maxdepth":     "max-depth",
+	"latitude":     "latitude",
+	"lat":          "latitude",
+	"longitude":    "longitude",
+	"lon":          "longitude",
+	"minradius":    "min-radius",
+	"maxradius":    "max-radius",
+	"eventid":      "eventid",
+}
+
+// fdsnBbox maps the FDSN event web service bounding box parameters to their position in --bbox.
+var fdsnBbox = map[string]int{
+	"minlongitude": 0,
+	"minlon":       0,
+	"maxlatitude":  1,
+	"maxlat":       1,
+	"maxlongitude": 2,
+	"maxlon":       2,
+	"minlatitude":  3,
+	"minlat":       3,
+}
+
+// fdsnNames replaces the search flags in error messages with the FDSN event web service parameters.
+var fdsnNames = strings.NewReplacer("--start", "starttime", "--end", "endtime", "--min-radius", "minradius", "--max-radius", "maxradius", "--", "")
+
+// fdsnTimes are the time formats allowed by the FDSN event web service.
+var fdsnTimes = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// setFDSN sets the search flags in fs from the FDSN event web service query parameters in v.  It is an
+// error to give a parameter for a flag that is already set.  orderby, offset, and limit are also set.
+func (s *search) setFDSN(fs *flag.FlagSet, v url.Values) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var names []string
+	for k := range v {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	bbox := []string{"-180", "90", "180", "-90"}
+	useBbox := false
+
+	for _, k := range names {
+		p := v.Get(k)
+
+		if i, ok := fdsnBbox[k]; ok {
+			if _, err := strconv.ParseFloat(p, 64); err != nil {
+				return fmt.Errorf("invalid %s %s", k, p)
+			}
+			bbox[i] = p
+			useBbox = true
+			continue
+		}
+
+		switch k {
+		case "orderby":
+			switch p {
+			case "time", "time-asc", "magnitude", "magnitude-asc":
+				s.orderBy = p
+			default:
+				return fmt.Errorf("invalid orderby %s", p)
+			}
+			continue
+		case "limit", "offset":
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid %s %s", k, p)
+			}
+			if k == "limit" {
+				s.limit = n
+			} else {
+				// FDSN offsets start at 1.
+				s.offset = n - 1
+			}
+			continue
+		}
+
+		f, ok := fdsnFlags[k]
+		if !ok {
+			return fmt.Errorf("unsupported parameter %s", k)
+		}
+
+		if set[f] {
+			return fmt.Errorf("%s and --%s can't both be used", k, f)
+		}
+		set[f] = true
+
+		if f == "start" || f == "end" {
+			t, err := fdsnTime(p)
+			if err != nil {
+				return fmt.Errorf("invalid %s %s", k, p)
+			}
+			p = t.Format(time.RFC3339)
+		}
+
+		if err := fs.Set(f, p); err != nil {
+			return fmt.Errorf("invalid %s %s", k, p)
+		}
+	}
+
+	if useBbox {
+		if set["bbox"] {
+			return errors.New("the bounding box parameters and --bbox can't both be used")
+		}
+		fs.Set("bbox", strings.Join(bbox, ","))
+	}
+
+	return nil
+}
+
+// fdsnTime parses an FDSN time.  Times without a time zone are UTC.
+func fdsnTime(s string) (t time.Time, err error) {
+	for _, f := range fdsnTimes {
+		if t, err = time.ParseInLocation(f, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// fdsnQuery handles FDSN event web service queries.  The quakes are output as QuakeML or in the FDSN
+// text format.
+func (sv *server) fdsnQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		fdsnError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	start := time.Now()
+
+	params := r.URL.Query()
+	key := "fdsnws?" + params.Encode()
+
+	format, nodata := "xml", http.StatusNoContent
+
+	if p := params.Get("format"); p != "" {
+		if p != "xml" && p != "text" {
+			fdsnError(w, r, http.StatusBadRequest, "invalid format "+p)
+			return
+		}
+		format = p
+	}
+
+	if p := params.Get("nodata"); p != "" {
+		if p != "204" && p != "404" {
+			fdsnError(w, r, http.StatusBadRequest, "invalid nodata "+p)
+			return
+		}
+		nodata, _ = strconv.Atoi(p)
+	}
+
+	for _, k := range []string{"includeallorigins", "includeallmagnitudes", "includearrivals"} {
+		if p := params.Get(k); p != "" && p != "false" {
+			fdsnError(w, r, http.StatusBadRequest, k+" is not supported")
+			return
+		}
+		params.Del(k)
+	}
+
+	params.Del("format")
+	params.Del("nodata")
+
+	if params.Get("orderby") == "" {
+		params.Set("orderby", "time")
+	}
+
+	fs := flag.NewFlagSet("fdsnws", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	var s search
+	s.addFlags(fs)
+
+	if err := s.setFDSN(fs, params); err != nil {
+		fdsnError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The WFS search needs a time range.
+	switch {
+	case s.start == "" && s.eventid == "":
+		fdsnError(w, r, http.StatusBadRequest, "starttime or eventid must be given")
+		return
+	case s.start != "" && s.end == "":
+		fs.Set("end", time.Now().UTC().Format(time.RFC3339))
+	}
+
+	query, err := s.query(fs, true)
+	if err != nil {
+		fdsnError(w, r, http.StatusBadRequest, fdsnNames.Replace(err.Error()))
+		return
+	}
+
+	c, ok := sv.cached(key)
+	if !ok {
+		var o outputs
+
+		// The text format is from the WFS only.
+		maxDetails := fdsnMaxDetails
+		if format == "text" {
+			maxDetails = 0
+		}
+
+		res, ok, err := sv.find(r, query, &o, maxDetails)
+		switch {
+		case !ok:
+			return
+		case err != nil:
+			log.Printf("%s: %v", r.URL, err)
+			fdsnError(w, r, http.StatusBadGateway, "error searching for quakes")
+			return
+		}
+
+		var b bytes.Buffer
+		c = response{expires: time.Now().Add(sv.ttl)}
+
+		if len(res.props) > 0 {
+			switch format {
+			case "text":
+				c.contentType = "text/plain; charset=utf-8"
+				err = writeFDSNText(&b, res)
+			case "xml":
+				c.contentType = "application/xml"
+				err = writeQuakeML(&b, res)
+			}
+		}
+
+		if err != nil {
+			log.Printf("%s: %v", r.URL, err)
+			fdsnError(w, r, http.StatusInternalServerError, "error writing the response")
+			return
+		}
+
+		c.body = b.Bytes()
+		sv.store(key, c)
+
+		infof("%s %d quakes in %s", r.URL, len(res.props), time.Since(start))
+	}
+
+	if len(c.body) == 0 {
+		if nodata == http.StatusNotFound {
+			fdsnError(w, r, http.StatusNotFound, "no quakes found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", c.contentType)
+	w.Write(c.body)
+}
+
+// fdsnError writes an error response in the format used by the FDSN web services.
+func fdsnError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "Error %d: %s\n\n%s\n\nRequest:\n%s\n\nRequest Submitted:\n%s\n\nService version:\n%s\n",
+		code, http.StatusText(code), msg, r.URL, time.Now().UTC().Format(time.RFC3339), fdsnVersion)
+}
+
+// writeFDSNText writes the quakes in res in the FDSN event text format.  The Author, Contributor, and
+// MagAuthor are from the quake details if they are in res and are otherwise empty.
+func writeFDSNText(w io.Writer, res results) error {
+	var b bytes.Buffer
+
+	b.WriteString("#EventID|Time|Latitude|Longitude|Depth/km|Author|Catalog|Contributor|ContributorID|MagType|Magnitude|MagAuthor|EventLocationName|EventType\n")
+
+	for i, p := range res.props {
+		var author, agency, magAuthor string
+
+		d, ok := res.details[p.PublicID]
+		if ok && d.PreferredOrigin != nil {
+			author = d.PreferredOrigin.CreationInfo.Author
+			agency = d.PreferredOrigin.CreationInfo.AgencyID
+		}
+		if ok && d.PreferredMagnitude != nil {
+			magAuthor = d.PreferredMagnitude.CreationInfo.Author
+		}
+
+		v := []string{
+			p.PublicID,
+			p.OriginTime,
+			strconv.FormatFloat(p.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(p.Longitude, 'f', -1, 64),
+			strconv.FormatFloat(p.Depth, 'f', -1, 64),
+			author,
+			"GeoNet",
+			agency,
+			p.PublicID,
+			p.MagnitudeType,
+			strconv.FormatFloat(p.Magnitude, 'f', -1, 64),
+			magAuthor,
+			res.quakes[i]["Description"],
+			res.quakes[i]["EventType"],
+		}
+
+		for j := range v {
+			v[j] = strings.Replace(v[j], "|", " ", -1)
+		}
+
+		b.WriteString(strings.Join(v, "|") + "\n")
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// fdsnVersionHandler returns the FDSN event web service version.
+func fdsnVersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, fdsnVersion)
+}
+
+// fdsnWADL returns the WADL describing the FDSN event web service query parameters.  Clients such as
+// ObsPy read it to find the parameters that are supported.
+func fdsnWADL(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	params := []struct{ name, typ string }{
+		{"starttime", "xsd:dateTime"},
+		{"endtime", "xsd:dateTime"},
+		{"minlatitude", "xsd:float"},
+		{"maxlatitude", "xsd:float"},
+		{"minlongitude", "xsd:float"},
+		{"maxlongitude", "xsd:float"},
+		{"latitude", "xsd:float"},
+		{"longitude", "xsd:float"},
+		{"minradius", "xsd:float"},
+		{"maxradius", "xsd:float"},
+		{"mindepth", "xsd:float"},
+		{"maxdepth", "xsd:float"},
+		{"minmagnitude", "xsd:float"},
+		{"maxmagnitude", "xsd:float"},
+		{"includeallorigins", "xsd:boolean"},
+		{"includeallmagnitudes", "xsd:boolean"},
+		{"includearrivals", "xsd:boolean"},
+		{"eventid", "xsd:string"},
+		{"limit", "xsd:int"},
+		{"offset", "xsd:int"},
+		{"orderby", "xsd:string"},
+		{"format", "xsd:string"},
+		{"nodata", "xsd:int"},
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<application xmlns="http://wadl.dev.java.net/2009/02" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+  <resources base="%s://%s/fdsnws/event/1/">
+    <resource path="query">
+      <method name="GET" id="query">
+        <request>
+`, scheme, html.EscapeString(r.Host))
+
+	for _, p := range params {
+		fmt.Fprintf(w, "          <param name=\"%s\" style=\"query\" type=\"%s\"/>\n", p.name, p.typ)
+	}
+
+	io.WriteString(w, `        </request>
+        <response status="200">
+          <representation mediaType="application/xml"/>
+          <representation mediaType="text/plain"/>
+        </response>
+        <response status="204 400 404 500 502"/>
+      </method>
+    </resource>
+    <resource path="version">
+      <method name="GET">
+        <response>
+          <representation mediaType="text/plain"/>
+        </response>
+      </method>
+    </resource>
+    <resource path="application.wadl">
+      <method name="GET">
+        <response>
+          <representation mediaType="application/xml"/>
+        </response>
+      </method>
+    </resource>
+  </resources>
+</application>
+`)
+}
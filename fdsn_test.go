@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetFDSN(t *testing.T) {
+	for _, v := range []struct {
+		params, flags string
+		err           bool
+		bbox, start   string
+		offset, limit int
+		orderBy       string
+	}{
+		{params: "starttime=2014-01-01&endtime=2014-02-01T12:00:00", start: "2014-01-01T00:00:00Z"},
+		{params: "minlat=-42&maxlat=-41", bbox: "-180,-41,180,-42"},
+		{params: "minlon=174&maxlon=175&minlatitude=-42&maxlatitude=-41", bbox: "174,-41,175,-42"},
+		// FDSN offsets start at 1.
+		{params: "offset=1&limit=10", offset: 0, limit: 10},
+		{params: "offset=11", offset: 10},
+		{params: "orderby=magnitude-asc", orderBy: "magnitude-asc"},
+		{params: "orderby=depth", err: true},
+		{params: "offset=0", err: true},
+		{params: "limit=ten", err: true},
+		{params: "minlat=south", err: true},
+		{params: "starttime=yesterday", err: true},
+		{params: "magnitudetype=ML", err: true},
+		{params: "starttime=2014-01-01", flags: "--start=2014-01-01T00:00:00Z", err: true},
+		{params: "minmag=3", flags: "--min-magnitude=2", err: true},
+		{params: "minlat=-42", flags: "--bbox=174,-41,175,-42", err: true},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+
+		var s search
+		s.addFlags(fs)
+
+		if v.flags != "" {
+			if err := fs.Parse([]string{v.flags}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		p, err := url.ParseQuery(v.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.setFDSN(fs, p)
+
+		switch {
+		case v.err && err == nil:
+			t.Errorf("%s %s expected an error", v.params, v.flags)
+			continue
+		case v.err:
+			continue
+		case err != nil:
+			t.Errorf("%s: %v", v.params, err)
+			continue
+		}
+
+		if v.start != "" && s.start != v.start {
+			t.Errorf("%s start expected %s, got %s", v.params, v.start, s.start)
+		}
+
+		if s.bbox != v.bbox {
+			t.Errorf("%s bbox expected %s, got %s", v.params, v.bbox, s.bbox)
+		}
+
+		if s.offset != v.offset || s.limit != v.limit || s.orderBy != v.orderBy {
+			t.Errorf("%s expected offset %d limit %d orderby %s, got %d %d %s", v.params, v.offset, v.limit, v.orderBy,
+				s.offset, s.limit, s.orderBy)
+		}
+	}
+}
+
+func TestFDSNTime(t *testing.T) {
+	for _, v := range []struct {
+		in, out string
+	}{
+		{"2014-07-23T06:04:43.625Z", "2014-07-23T06:04:43.625Z"},
+		{"2014-07-23T18:04:43+12:00", "2014-07-23T06:04:43Z"},
+		// Times without a time zone are UTC.
+		{"2014-07-23T06:04:43.625", "2014-07-23T06:04:43.625Z"},
+		{"2014-07-23T06:04:43", "2014-07-23T06:04:43Z"},
+		{"2014-07-23", "2014-07-23T00:00:00Z"},
+		{"2014-07-23 06:04:43", ""},
+		{"", ""},
+	} {
+		tm, err := fdsnTime(v.in)
+
+		switch {
+		case v.out == "" && err == nil:
+			t.Errorf("fdsnTime(%q) expected an error", v.in)
+		case v.out == "":
+		case err != nil:
+			t.Errorf("fdsnTime(%q): %v", v.in, err)
+		case tm.UTC().Format(time.RFC3339Nano) != v.out:
+			t.Errorf("fdsnTime(%q) expected %s, got %s", v.in, v.out, tm.UTC().Format(time.RFC3339Nano))
+		}
+	}
+}
+
+func TestWriteFDSNText(t *testing.T) {
+	res := results{
+		props: []wfs.Properties{
+			{PublicID: "2014p549333", OriginTime: "2014-07-23T06:04:43.625Z", Latitude: -41.5, Longitude: 174.25, Depth: 12.5,
+				MagnitudeType: "ML", Magnitude: 2.64},
+			{PublicID: "2014p549334", OriginTime: "2014-07-23T07:04:43.625Z", Latitude: -42, Longitude: 173, Depth: 5,
+				MagnitudeType: "M", Magnitude: 3},
+		},
+		quakes: []map[string]string{
+			{"Description": "10 km north of Seddon|Marlborough", "EventType": "earthquake"},
+			{"Description": "", "EventType": ""},
+		},
+		details: map[string]seiscompml07.Event{
+			"2014p549333": {
+				PreferredOrigin:    &seiscompml07.Origin{CreationInfo: seiscompml07.CreationInfo{AgencyID: "WEL(GNS_Primary)", Author: "scautoloc"}},
+				PreferredMagnitude: &seiscompml07.Magnitude{CreationInfo: seiscompml07.CreationInfo{Author: "scmag"}},
+			},
+		},
+	}
+
+	var b bytes.Buffer
+
+	if err := writeFDSNText(&b, res); err != nil {
+		t.Fatal(err)
+	}
+
+	l := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+
+	if len(l) != 3 {
+		t.Fatal("expected 3 lines, got ", len(l))
+	}
+
+	if l[0] != "#EventID|Time|Latitude|Longitude|Depth/km|Author|Catalog|Contributor|ContributorID|MagType|Magnitude|MagAuthor|EventLocationName|EventType" {
+		t.Error("incorrect header, got ", l[0])
+	}
+
+	// The | in the description is replaced.
+	if l[1] != "2014p549333|2014-07-23T06:04:43.625Z|-41.5|174.25|12.5|scautoloc|GeoNet|WEL(GNS_Primary)|2014p549333|ML|2.64|scmag|10 km north of Seddon Marlborough|earthquake" {
+		t.Error("incorrect line, got ", l[1])
+	}
+
+	// Quakes without details have empty authors.
+	if l[2] != "2014p549334|2014-07-23T07:04:43.625Z|-42|173|5||GeoNet||2014p549334|M|3|||" {
+		t.Error("incorrect line without details, got ", l[2])
+	}
+}
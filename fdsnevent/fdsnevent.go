@@ -0,0 +1,450 @@
+// Package fdsnevent searches an FDSN event web service for quakes.  The search criteria are the
+// same as for the WFS and the quakes are returned as WFS properties so that either service can be
+// used for searching.
+package fdsnevent
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/GeoNet/qsearch/progress"
+	"github.com/GeoNet/qsearch/wfs"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URL is the FDSN event web service query endpoint.
+var URL = "https://service.geonet.org.nz/fdsnws/event/1/query"
+
+// Format is the format that is requested from the service; xml for QuakeML or text.  The text
+// format is smaller but only has the location, magnitude, and type of each quake.
+var Format = "xml"
+
+// Progress is called with the URLs that are fetched and the number of quakes found as a search
+// progresses.
+var Progress progress.Func = progress.Log
+
+// fdsnTime is the time format for the FDSN query parameters.
+const fdsnTime = "2006-01-02T15:04:05"
+
+// Properties searches the FDSN event web service for quakes based on the query and returns the WFS
+// properties for each quake.  The quakes are ordered as for wfs.Query.Properties.
+func Properties(q wfs.Query) (p []wfs.Properties, err error) {
+	urls, local, err := queryURLs(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err = search(urls)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.EventIDs) == 0 && q.EventID == "" && q.MinUsedPhaseCount > 0 {
+		f := p[:0]
+		for _, v := range p {
+			if v.UsedPhaseCount >= q.MinUsedPhaseCount {
+				f = append(f, v)
+			}
+		}
+		p = f
+	}
+
+	// The service has already applied the offset and limit unless they are applied locally.
+	if !local {
+		q.Offset = 0
+		q.Limit = 0
+	}
+
+	return q.Order(p)
+}
+
+// queryURLs returns the URLs to query for q.  There is one URL for each eventid.  local is true if
+// the offset and limit must be applied after the search.
+func queryURLs(q wfs.Query) (urls []string, local bool, err error) {
+	ids := q.EventIDs
+	if len(ids) == 0 && q.EventID != "" {
+		ids = []string{q.EventID}
+	}
+
+	if len(ids) > 0 {
+		for _, id := range ids {
+			v := url.Values{}
+			v.Set("eventid", id)
+			urls = append(urls, queryURL(v))
+		}
+		return urls, true, nil
+	}
+
+	v := url.Values{}
+	v.Set("starttime", q.Start.UTC().Format(fdsnTime))
+	v.Set("endtime", q.End.UTC().Format(fdsnTime))
+
+	if q.MinMagnitude != -999.9 {
+		v.Set("minmagnitude", fmt.Sprint(q.MinMagnitude))
+	}
+	if q.MaxMagnitude != nil {
+		v.Set("maxmagnitude", fmt.Sprint(*q.MaxMagnitude))
+	}
+	if q.MinDepth != nil {
+		v.Set("mindepth", fmt.Sprint(*q.MinDepth))
+	}
+	if q.MaxDepth != nil {
+		v.Set("maxdepth", fmt.Sprint(*q.MaxDepth))
+	}
+
+	if q.Bbox != "" {
+		b := strings.Split(q.Bbox, ",")
+		if len(b) != 4 {
+			return nil, false, errors.New("invalid bbox " + q.Bbox)
+		}
+		c := make([]float64, 4)
+		for i := range b {
+			if c[i], err = strconv.ParseFloat(strings.TrimSpace(b[i]), 64); err != nil {
+				return nil, false, errors.New("invalid bbox " + q.Bbox)
+			}
+		}
+		v.Set("minlongitude", fmt.Sprint(math.Min(c[0], c[2])))
+		v.Set("maxlongitude", fmt.Sprint(math.Max(c[0], c[2])))
+		v.Set("minlatitude", fmt.Sprint(math.Min(c[1], c[3])))
+		v.Set("maxlatitude", fmt.Sprint(math.Max(c[1], c[3])))
+	}
+
+	if !q.ModifiedSince.IsZero() {
+		v.Set("updatedafter", q.ModifiedSince.UTC().Format(fdsnTime))
+	}
+
+	if q.Circle != nil {
+		v.Set("latitude", fmt.Sprint(q.Circle.Latitude))
+		v.Set("longitude", fmt.Sprint(q.Circle.Longitude))
+		v.Set("minradius", fmt.Sprint(q.Circle.MinRadius))
+		v.Set("maxradius", fmt.Sprint(q.Circle.MaxRadius))
+	}
+
+	// The service can't filter on the used phase count.  It is filtered after the search so the
+	// offset and limit must be applied after that.
+	local = q.MinUsedPhaseCount > 0
+
+	if local && Format == "text" {
+		return nil, false, errors.New("the used phase count is not in the text format")
+	}
+
+	switch q.OrderBy {
+	case "":
+		v.Set("orderby", "time-asc")
+	default:
+		v.Set("orderby", q.OrderBy)
+	}
+
+	if !local {
+		if q.Offset > 0 {
+			v.Set("offset", strconv.Itoa(q.Offset+1))
+		}
+		if q.Limit > 0 {
+			v.Set("limit", strconv.Itoa(q.Limit))
+		}
+	}
+
+	return []string{queryURL(v)}, local, nil
+}
+
+// queryURL returns the query URL for the parameters v.
+func queryURL(v url.Values) string {
+	v.Set("format", Format)
+
+	sep := "?"
+	if strings.Contains(URL, "?") {
+		sep = "&"
+	}
+
+	return URL + sep + v.Encode()
+}
+
+type result struct {
+	url   string
+	props []wfs.Properties
+	err   error
+}
+
+// search fetches the urls and returns the quakes.  Quakes found by more than one URL are only
+// returned once.
+func search(urls []string) (p []wfs.Properties, err error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	u := make(chan string)
+
+	go func() {
+		defer close(u)
+		for _, s := range urls {
+			select {
+			case u <- s:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	c := make(chan result)
+	var wg sync.WaitGroup
+	const numDownloaders = 10
+	wg.Add(numDownloaders)
+	for i := 0; i < numDownloaders; i++ {
+		go func() {
+			fetcher(done, u, c)
+			wg.Done()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(c)
+	}()
+
+	seen := make(map[string]bool)
+
+	for r := range c {
+		Progress(progress.Event{Source: "fdsnevent", Kind: progress.Request, URL: r.url})
+		if r.err != nil {
+			return nil, r.err
+		}
+		for _, v := range r.props {
+			if !seen[v.PublicID] {
+				seen[v.PublicID] = true
+				p = append(p, v)
+			}
+		}
+		Progress(progress.Event{Source: "fdsnevent", Kind: progress.Quakes, Done: len(p)})
+	}
+
+	return p, nil
+}
+
+func fetcher(done <-chan struct{}, urls <-chan string, c chan<- result) {
+	client := &http.Client{}
+
+	for u := range urls {
+		var b []byte
+		var p []wfs.Properties
+
+		r, err := client.Get(u)
+
+		if err == nil {
+			b, err = ioutil.ReadAll(r.Body)
+			r.Body.Close()
+		}
+
+		switch {
+		case err != nil:
+		case r.StatusCode == http.StatusNoContent:
+		case r.StatusCode != http.StatusOK:
+			err = fmt.Errorf("Non 200 response code: %d", r.StatusCode)
+		case Format == "text":
+			p, err = unmarshalText(b)
+		default:
+			p, err = unmarshalQuakeML(b)
+		}
+
+		select {
+		case c <- result{u, p, err}:
+		case <-done:
+			return
+		}
+	}
+}
+
+// unmarshalText returns the quakes in the FDSN event text format in b.  The columns are found from the
+// header line.
+func unmarshalText(b []byte) (p []wfs.Properties, err error) {
+	col := make(map[string]int)
+
+	for n, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimRight(l, "\r")
+		if l == "" {
+			continue
+		}
+
+		f := strings.Split(l, "|")
+
+		if strings.HasPrefix(l, "#") {
+			for i, h := range f {
+				col[strings.TrimSpace(strings.TrimPrefix(h, "#"))] = i
+			}
+			continue
+		}
+
+		if len(col) == 0 {
+			return nil, errors.New("no header line in the text format")
+		}
+
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(f) {
+				return strings.TrimSpace(f[i])
+			}
+			return ""
+		}
+
+		var v wfs.Properties
+
+		v.PublicID = get("EventID")
+		v.EventType = get("EventType")
+		v.MagnitudeType = get("MagType")
+
+		if v.OriginTime, err = normaliseTime(get("Time")); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+
+		for _, x := range []struct {
+			name string
+			v    *float64
+		}{
+			{"Latitude", &v.Latitude},
+			{"Longitude", &v.Longitude},
+			{"Depth/km", &v.Depth},
+			{"Magnitude", &v.Magnitude},
+		} {
+			s := get(x.name)
+			if s == "" {
+				continue
+			}
+			if *x.v, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s %s", n+1, x.name, s)
+			}
+		}
+
+		p = append(p, v)
+	}
+
+	return p, nil
+}
+
+// QuakeML types for unmarshalling the preferred origin and magnitude of each event.
+type quakeML struct {
+	Events []event `xml:"eventParameters>event"`
+}
+
+type event struct {
+	PublicID             string       `xml:"publicID,attr"`
+	PreferredOriginID    string       `xml:"preferredOriginID"`
+	PreferredMagnitudeID string       `xml:"preferredMagnitudeID"`
+	Type                 string       `xml:"type"`
+	CreationInfo         creationInfo `xml:"creationInfo"`
+	Origins              []origin     `xml:"origin"`
+	Magnitudes           []magnitude  `xml:"magnitude"`
+}
+
+type origin struct {
+	PublicID         string  `xml:"publicID,attr"`
+	Time             string  `xml:"time>value"`
+	Latitude         float64 `xml:"latitude>value"`
+	Longitude        float64 `xml:"longitude>value"`
+	Depth            float64 `xml:"depth>value"`
+	DepthType        string  `xml:"depthType"`
+	MethodID         string  `xml:"methodID"`
+	EarthModelID     string  `xml:"earthModelID"`
+	Quality          quality `xml:"quality"`
+	EvaluationMode   string  `xml:"evaluationMode"`
+	EvaluationStatus string  `xml:"evaluationStatus"`
+}
+
+type quality struct {
+	UsedPhaseCount   int     `xml:"usedPhaseCount"`
+	UsedStationCount int     `xml:"usedStationCount"`
+	StandardError    float64 `xml:"standardError"`
+	AzimuthalGap     float64 `xml:"azimuthalGap"`
+	MinimumDistance  float64 `xml:"minimumDistance"`
+}
+
+type magnitude struct {
+	PublicID     string  `xml:"publicID,attr"`
+	Mag          float64 `xml:"mag>value"`
+	Uncertainty  float64 `xml:"mag>uncertainty"`
+	Type         string  `xml:"type"`
+	StationCount int     `xml:"stationCount"`
+}
+
+type creationInfo struct {
+	CreationTime string `xml:"creationTime"`
+}
+
+// unmarshalQuakeML returns the quakes in the QuakeML in b.  The properties are from the preferred
+// origin and magnitude of each event.  Resource identifiers are shortened to the part after the
+// last / e.g., smi:nz.org.geonet/2014p549333 is 2014p549333.  Depths are converted to km.
+func unmarshalQuakeML(b []byte) (p []wfs.Properties, err error) {
+	var q quakeML
+
+	if err = xml.Unmarshal(b, &q); err != nil {
+		return nil, err
+	}
+
+	for _, e := range q.Events {
+		v := wfs.Properties{
+			PublicID:  shortID(e.PublicID),
+			EventType: e.Type,
+		}
+
+		// QuakeML 1.2 has no modification time so the event creation time is used.
+		v.ModificationTime = e.CreationInfo.CreationTime
+		if v.ModificationTime != "" {
+			if v.ModificationTime, err = normaliseTime(v.ModificationTime); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, o := range e.Origins {
+			if o.PublicID != e.PreferredOriginID && !(i == 0 && e.PreferredOriginID == "") {
+				continue
+			}
+			if v.OriginTime, err = normaliseTime(o.Time); err != nil {
+				return nil, err
+			}
+			v.Latitude = o.Latitude
+			v.Longitude = o.Longitude
+			v.Depth = o.Depth / 1000
+			v.DepthType = o.DepthType
+			v.EvaluationMethod = shortID(o.MethodID)
+			v.EarthModel = shortID(o.EarthModelID)
+			v.EvaluationMode = o.EvaluationMode
+			v.EvaluationStatus = o.EvaluationStatus
+			v.OriginError = o.Quality.StandardError
+			v.UsedPhaseCount = o.Quality.UsedPhaseCount
+			v.UsedStationCount = o.Quality.UsedStationCount
+			v.MinimumDistance = o.Quality.MinimumDistance
+			v.AzimuthalGap = o.Quality.AzimuthalGap
+		}
+
+		for i, m := range e.Magnitudes {
+			if m.PublicID != e.PreferredMagnitudeID && !(i == 0 && e.PreferredMagnitudeID == "") {
+				continue
+			}
+			v.Magnitude = m.Mag
+			v.MagnitudeType = m.Type
+			v.MagnitudeUncertainty = m.Uncertainty
+			v.MagnitudeStationCount = m.StationCount
+		}
+
+		p = append(p, v)
+	}
+
+	return p, nil
+}
+
+// shortID returns the part of the resource identifier id after the last /.
+func shortID(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// normaliseTime returns the FDSN time s as an RFC3339 time in UTC.  Times without a time zone are UTC.
+func normaliseTime(s string) (string, error) {
+	for _, f := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.ParseInLocation(f, s, time.UTC); err == nil {
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return "", errors.New("invalid time " + s)
+}
@@ -0,0 +1,252 @@
+package fdsnevent
+
+import (
+	"github.com/GeoNet/qsearch/wfs"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestQueryURLs(t *testing.T) {
+	s, _ := time.Parse(time.RFC3339, "2014-01-27T03:06:25Z")
+	e, _ := time.Parse(time.RFC3339, "2014-01-27T04:06:25Z")
+
+	u, local, err := queryURLs(wfs.Query{EventIDs: []string{"2014p562279", "2014p562280"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(u) != 2 || !local {
+		t.Error("expected 2 urls for eventids applied locally, got ", u, local)
+	}
+
+	if v := params(t, u[0]); v.Get("eventid") != "2014p562279" || v.Get("format") != "xml" {
+		t.Error("incorrect for eventid, got ", u[0])
+	}
+
+	max := 6.5
+	q := wfs.Query{Start: s, End: e, MinUsedPhaseCount: -999, MinMagnitude: 3.5, MaxMagnitude: &max,
+		Bbox: "175,-41,174,-42", OrderBy: "magnitude", Offset: 10, Limit: 5}
+
+	u, local, err = queryURLs(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(u) != 1 || local {
+		t.Error("expected 1 url applied by the service, got ", u, local)
+	}
+
+	v := params(t, u[0])
+
+	for k, x := range map[string]string{
+		"starttime":    "2014-01-27T03:06:25",
+		"endtime":      "2014-01-27T04:06:25",
+		"minmagnitude": "3.5",
+		"maxmagnitude": "6.5",
+		"minlongitude": "174",
+		"maxlongitude": "175",
+		"minlatitude":  "-42",
+		"maxlatitude":  "-41",
+		"orderby":      "magnitude",
+		"offset":       "11",
+		"limit":        "5",
+	} {
+		if v.Get(k) != x {
+			t.Errorf("%s expected %s, got %s", k, x, v.Get(k))
+		}
+	}
+
+	q = wfs.Query{Start: s, End: e, MinUsedPhaseCount: 60, MinMagnitude: -999.9, Offset: 10, Limit: 5, ModifiedSince: s}
+
+	u, local, err = queryURLs(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v = params(t, u[0]); !local || v.Get("offset") != "" || v.Get("limit") != "" || v.Get("minmagnitude") != "" {
+		t.Error("incorrect for min phase count, got ", u[0])
+	}
+
+	if v.Get("updatedafter") != "2014-01-27T03:06:25" {
+		t.Error("updatedafter expected 2014-01-27T03:06:25, got ", v.Get("updatedafter"))
+	}
+
+	if v.Get("orderby") != "time-asc" {
+		t.Error("orderby expected time-asc, got ", v.Get("orderby"))
+	}
+
+	Format = "text"
+	defer func() { Format = "xml" }()
+
+	if _, _, err = queryURLs(q); err == nil {
+		t.Error("expected an error for min phase count with the text format")
+	}
+}
+
+func params(t *testing.T, s string) url.Values {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Query()
+}
+
+func TestUnmarshalText(t *testing.T) {
+	b, err := ioutil.ReadFile("etc/query.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := unmarshalText(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p) != 2 {
+		t.Fatal("expected 2 quakes, got ", len(p))
+	}
+
+	v := p[0]
+
+	if v.PublicID != "2014p549333" {
+		t.Error("PublicID expected 2014p549333, got ", v.PublicID)
+	}
+
+	if v.OriginTime != "2014-07-23T06:04:43.625Z" {
+		t.Error("OriginTime expected 2014-07-23T06:04:43.625Z, got ", v.OriginTime)
+	}
+
+	if v.Latitude != -39.648535 {
+		t.Error("Latitude expected -39.648535, got ", v.Latitude)
+	}
+
+	if v.Longitude != 173.47803 {
+		t.Error("Longitude expected 173.47803, got ", v.Longitude)
+	}
+
+	if v.Depth != 7.34375 {
+		t.Error("Depth expected 7.34375, got ", v.Depth)
+	}
+
+	if v.Magnitude != 2.6416703 {
+		t.Error("Magnitude expected 2.6416703, got ", v.Magnitude)
+	}
+
+	if v.MagnitudeType != "M" {
+		t.Error("MagnitudeType expected M, got ", v.MagnitudeType)
+	}
+
+	if v.EventType != "earthquake" {
+		t.Error("EventType expected earthquake, got ", v.EventType)
+	}
+
+	if p[1].OriginTime != "2014-07-23T06:40:01Z" {
+		t.Error("OriginTime expected 2014-07-23T06:40:01Z, got ", p[1].OriginTime)
+	}
+
+	if p[1].Magnitude != 0.0 || p[1].MagnitudeType != "" {
+		t.Error("expected no magnitude, got ", p[1].Magnitude, p[1].MagnitudeType)
+	}
+
+	if _, err = unmarshalText([]byte("2014p549333|2014-07-23T06:04:43.625\n")); err == nil {
+		t.Error("expected an error with no header line")
+	}
+}
+
+func TestUnmarshalQuakeML(t *testing.T) {
+	b, err := ioutil.ReadFile("etc/query.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := unmarshalQuakeML(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p) != 2 {
+		t.Fatal("expected 2 quakes, got ", len(p))
+	}
+
+	v := p[0]
+
+	if v.PublicID != "2014p549333" {
+		t.Error("PublicID expected 2014p549333, got ", v.PublicID)
+	}
+
+	// From the preferred origin which is not the first.
+	if v.OriginTime != "2014-07-23T06:04:43.625Z" {
+		t.Error("OriginTime expected 2014-07-23T06:04:43.625Z, got ", v.OriginTime)
+	}
+
+	// The event creation time as QuakeML 1.2 has no modification time.
+	if v.ModificationTime != "2014-07-23T06:05:10.1Z" {
+		t.Error("ModificationTime expected 2014-07-23T06:05:10.1Z, got ", v.ModificationTime)
+	}
+
+	if v.Latitude != -39.648535 {
+		t.Error("Latitude expected -39.648535, got ", v.Latitude)
+	}
+
+	if v.Depth != 7.34375 {
+		t.Error("Depth expected 7.34375, got ", v.Depth)
+	}
+
+	if v.DepthType != "from location" {
+		t.Error("DepthType expected from location, got ", v.DepthType)
+	}
+
+	if v.EvaluationMethod != "NonLinLoc" {
+		t.Error("EvaluationMethod expected NonLinLoc, got ", v.EvaluationMethod)
+	}
+
+	if v.EarthModel != "nz3drx" {
+		t.Error("EarthModel expected nz3drx, got ", v.EarthModel)
+	}
+
+	if v.EvaluationMode != "automatic" {
+		t.Error("EvaluationMode expected automatic, got ", v.EvaluationMode)
+	}
+
+	if v.UsedPhaseCount != 23 {
+		t.Error("UsedPhaseCount expected 23, got ", v.UsedPhaseCount)
+	}
+
+	if v.UsedStationCount != 21 {
+		t.Error("UsedStationCount expected 21, got ", v.UsedStationCount)
+	}
+
+	if v.AzimuthalGap != 206.88617 {
+		t.Error("AzimuthalGap expected 206.88617, got ", v.AzimuthalGap)
+	}
+
+	if v.Magnitude != 2.6416703 {
+		t.Error("Magnitude expected 2.6416703, got ", v.Magnitude)
+	}
+
+	if v.MagnitudeUncertainty != 0.1 {
+		t.Error("MagnitudeUncertainty expected 0.1, got ", v.MagnitudeUncertainty)
+	}
+
+	if v.MagnitudeStationCount != 13 {
+		t.Error("MagnitudeStationCount expected 13, got ", v.MagnitudeStationCount)
+	}
+
+	// No preferred origin so the first is used.
+	v = p[1]
+
+	if v.OriginTime != "2014-07-23T06:40:01Z" {
+		t.Error("OriginTime expected 2014-07-23T06:40:01Z, got ", v.OriginTime)
+	}
+
+	if v.ModificationTime != "2014-07-23T06:41:00Z" {
+		t.Error("ModificationTime expected 2014-07-23T06:41:00Z, got ", v.ModificationTime)
+	}
+
+	if v.Depth != 21.5 {
+		t.Error("Depth expected 21.5, got ", v.Depth)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// followOverlap is how far before the latest modification time in the state or mirror each search
+// starts.  It allows for quakes that are in the search after quakes with a later modification time.
+const followOverlap = 10 * time.Minute
+
+// followFlags holds the flags for outputting new and changed quakes.
+type followFlags struct {
+	follow   bool
+	state    string
+	interval time.Duration
+	window   time.Duration
+}
+
+// followState is the state that is kept between searches.  Modified is the latest modification time
+// that has been found and Events are the modification times of the quakes that have been output.
+type followState struct {
+	Modified time.Time         `json:"modified"`
+	Events   map[string]string `json:"events"`
+}
+
+// addFlags adds the follow flags to fs.
+func (f *followFlags) addFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&f.follow, "follow", false,
+		"search again every --interval and output only the quakes that are new or have changed.  --start is optional and --end can't be used.")
+	fs.StringVar(&f.state, "state", "",
+		"output only the quakes that are new or have changed since the last run with this state file.  The state file is updated after the output is written.  With --follow and --cache the default is a file in the cache directory.")
+	fs.DurationVar(&f.interval, "interval", time.Minute, "the time between searches for --follow.")
+	fs.DurationVar(&f.window, "window", 24*time.Hour,
+		"with --follow or --state and without --start search for quakes with an origin time in this window before now.")
+}
+
+// check checks the follow flags for the command name.  The state file defaults to a file in the cache
+// directory for --follow.
+func (f *followFlags) check(fs *flag.FlagSet, name string, o *outputs) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if !f.follow && f.state == "" {
+		return nil
+	}
+
+	if anySet(set, eventidFlags) || set["end"] {
+		return errors.New("--eventid, --eventid-file, --fdsn, and --end can't be used with --follow or --state")
+	}
+
+	if backend != "wfs" {
+		return errors.New("--backend " + backend + " has no modification times and can't be used with --follow or --state")
+	}
+
+	if f.follow && (o.eventOut != "" || o.picksOut != "" || o.arrivalsOut != "" || o.parquetDir != "") {
+		return errors.New("--out and --parquet can't be used with --follow.  The output is written to stdout.")
+	}
+
+	if f.interval <= 0 || f.window <= 0 {
+		return errors.New("--interval and --window must be greater than 0")
+	}
+
+	if f.follow && f.state == "" && seiscompml07.CacheDir != "" {
+		f.state = filepath.Join(seiscompml07.CacheDir, "follow-"+name+".json")
+	}
+
+	return nil
+}
+
+// follow searches for quakes with the criteria in s and writes the outputs selected in o for the quakes
+// that are not in the state file or have changed.  With --follow this is repeated every interval.  The
+// state is saved after the output is written so that no quakes are missed if qsearch is stopped.
+func (f *followFlags) run(s *search, fs *flag.FlagSet, o *outputs) {
+	o.validate()
+
+	st, err := readState(f.state)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := s.start
+
+	for {
+		now := time.Now().UTC()
+
+		s.start = start
+		if s.start == "" {
+			s.start = now.Add(-f.window).Format(time.RFC3339)
+		}
+		// Allow for the clock being behind the service.
+		s.end = now.Add(time.Hour).Format(time.RFC3339)
+
+		query, err := s.query(fs, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if !st.Modified.IsZero() {
+			query.ModifiedSince = st.Modified.Add(-followOverlap)
+		}
+
+		infof("Searching for new and changed quakes")
+
+		props, err := searchQuakes(query)
+		switch {
+		case err != nil && f.follow:
+			log.Printf("Error searching for quakes: %v", err)
+		case err != nil:
+			log.Println("Error searching for quakes.")
+			log.Fatal(err)
+		default:
+			c := st.changed(props)
+
+			infof("Found %d new or changed quakes", len(c))
+
+			var retry map[string]bool
+
+			if len(c) > 0 {
+				r := findDetails(c, o, false)
+				o.write(r, nil)
+				// Only the first output has a header.
+				o.header = false
+
+				if retry = unwritten(c, r.details); len(retry) > 0 {
+					warnf("Searching again for %d quakes without details.", len(retry))
+				}
+			}
+
+			st.update(props, retry)
+
+			if err = st.write(f.state); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if !f.follow {
+			return
+		}
+
+		time.Sleep(f.interval)
+	}
+}
+
+// readState reads the state from file.  The state is empty if file is empty or does not exist.
+func readState(file string) (st followState, err error) {
+	st.Events = make(map[string]string)
+
+	if file == "" {
+		return st, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+		return st, nil
+	case err != nil:
+		return st, err
+	}
+
+	if err = json.Unmarshal(b, &st); err != nil {
+		return st, errors.New("invalid state file " + file + ": " + err.Error())
+	}
+
+	if st.Events == nil {
+		st.Events = make(map[string]string)
+	}
+
+	return st, nil
+}
+
+// write writes the state to file.  The state is written to a temporary file that is renamed so that
+// the state file is always complete.  Nothing is written if file is empty.
+func (st *followState) write(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	t := file + ".tmp"
+
+	if err = ioutil.WriteFile(t, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(t, file)
+}
+
+// changed returns the quakes in p that are not in the state or have a different modification time.
+func (st *followState) changed(p []wfs.Properties) (c []wfs.Properties) {
+	for _, v := range p {
+		if m, ok := st.Events[v.PublicID]; !ok || m != v.ModificationTime {
+			c = append(c, v)
+		}
+	}
+
+	return c
+}
+
+// update adds the quakes in p to the state except for those in retry, which are not output yet.  The
+// latest modification time is kept before the quakes in retry so that the next search finds them
+// again.  Quakes that were modified before the overlap with the next search are removed as they can't
+// be found again without being modified.
+func (st *followState) update(p []wfs.Properties, retry map[string]bool) {
+	var earliest time.Time
+
+	for _, v := range p {
+		m, err := time.Parse(time.RFC3339Nano, v.ModificationTime)
+
+		if retry[v.PublicID] {
+			if err == nil && (earliest.IsZero() || m.Before(earliest)) {
+				earliest = m
+			}
+			continue
+		}
+
+		st.Events[v.PublicID] = v.ModificationTime
+
+		if err == nil && m.After(st.Modified) {
+			st.Modified = m
+		}
+	}
+
+	if !earliest.IsZero() && st.Modified.After(earliest) {
+		st.Modified = earliest
+	}
+
+	for k, v := range st.Events {
+		if m, err := time.Parse(time.RFC3339Nano, v); err == nil && m.Before(st.Modified.Add(-followOverlap)) {
+			delete(st.Events, k)
+		}
+	}
+}
+
+// unwritten returns the eventids of the quakes in c that have no details when details were fetched.
+// Their details were not output.
+func unwritten(c []wfs.Properties, details map[string]seiscompml07.Event) (u map[string]bool) {
+	if details == nil {
+		return nil
+	}
+
+	u = make(map[string]bool)
+
+	for _, v := range c {
+		if _, ok := details[v.PublicID]; !ok {
+			u[v.PublicID] = true
+		}
+	}
+
+	return u
+}
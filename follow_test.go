@@ -0,0 +1,140 @@
+package main
+
+import (
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollowStateChanged(t *testing.T) {
+	st := followState{Events: map[string]string{
+		"a": "2014-07-23T06:04:43.625Z",
+		"b": "2014-07-23T07:00:00Z",
+	}}
+
+	c := st.changed([]wfs.Properties{
+		{PublicID: "a", ModificationTime: "2014-07-23T06:04:43.625Z"},
+		{PublicID: "b", ModificationTime: "2014-07-23T07:10:00Z"},
+		{PublicID: "c", ModificationTime: "2014-07-23T07:20:00Z"},
+	})
+
+	if len(c) != 2 || c[0].PublicID != "b" || c[1].PublicID != "c" {
+		t.Error("expected b and c to have changed, got ", c)
+	}
+}
+
+func TestFollowStateUpdate(t *testing.T) {
+	st := followState{Events: map[string]string{
+		"old": "2014-07-23T05:00:00Z",
+		"a":   "2014-07-23T06:55:00Z",
+	}}
+
+	st.update([]wfs.Properties{
+		{PublicID: "b", ModificationTime: "2014-07-23T07:00:00Z"},
+		{PublicID: "c", ModificationTime: "2014-07-23T06:51:00.5Z"},
+		// Invalid times are kept but don't change the latest modification time.
+		{PublicID: "d", ModificationTime: ""},
+	}, nil)
+
+	if s := st.Modified.Format(time.RFC3339); s != "2014-07-23T07:00:00Z" {
+		t.Error("Modified expected 2014-07-23T07:00:00Z, got ", s)
+	}
+
+	// Quakes modified before the overlap with the next search are removed.
+	for k, v := range map[string]bool{"old": false, "a": true, "b": true, "c": true, "d": true} {
+		if _, ok := st.Events[k]; ok != v {
+			t.Errorf("%s expected in the state %t, got %t", k, v, ok)
+		}
+	}
+
+	if st.Events["c"] != "2014-07-23T06:51:00.5Z" {
+		t.Error("c expected 2014-07-23T06:51:00.5Z, got ", st.Events["c"])
+	}
+}
+
+func TestFollowStateRetry(t *testing.T) {
+	st := followState{Events: make(map[string]string)}
+
+	p := []wfs.Properties{
+		{PublicID: "a", ModificationTime: "2014-07-23T07:00:00Z"},
+		{PublicID: "b", ModificationTime: "2014-07-23T06:30:00Z"},
+	}
+
+	// The details for b fail to download on the first pass.
+	c := st.changed(p)
+
+	retry := unwritten(c, map[string]seiscompml07.Event{"a": {}})
+	if len(retry) != 1 || !retry["b"] {
+		t.Fatal("expected to retry b, got ", retry)
+	}
+
+	st.update(p, retry)
+
+	if _, ok := st.Events["b"]; ok {
+		t.Error("expected b not to be in the state")
+	}
+
+	// The next search finds b again.
+	if s := st.Modified.Add(-followOverlap); !s.Before(time.Date(2014, 7, 23, 6, 30, 0, 0, time.UTC)) {
+		t.Error("expected the next search to be before b was modified, got ", s)
+	}
+
+	c = st.changed(p)
+	if len(c) != 1 || c[0].PublicID != "b" {
+		t.Fatal("expected b to be changed on the next pass, got ", c)
+	}
+
+	if retry = unwritten(c, map[string]seiscompml07.Event{"b": {}}); len(retry) != 0 {
+		t.Error("expected nothing to retry after the details for b were found, got ", retry)
+	}
+
+	st.update(p, retry)
+
+	// b is before the overlap with the next search so it is no longer kept.
+	if s := st.Modified.Format(time.RFC3339); s != "2014-07-23T07:00:00Z" {
+		t.Error("Modified expected 2014-07-23T07:00:00Z, got ", s)
+	}
+
+	// Without details there is nothing to retry.
+	if u := unwritten(p, nil); len(u) != 0 {
+		t.Error("expected nothing to retry without details, got ", u)
+	}
+}
+
+func TestFollowStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "state", "follow.json")
+
+	st, err := readState(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(st.Events) != 0 || !st.Modified.IsZero() {
+		t.Error("expected an empty state, got ", st)
+	}
+
+	st.update([]wfs.Properties{{PublicID: "a", ModificationTime: "2014-07-23T07:00:00Z"}}, nil)
+
+	if err = st.write(name); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := readState(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Modified.Equal(st.Modified) || r.Events["a"] != "2014-07-23T07:00:00Z" {
+		t.Error("expected the state to be read back, got ", r)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io"
+	"math"
+)
+
+const (
+	// ellipsePoints is the number of points used to draw an error ellipse.
+	ellipsePoints = 72
+	// kmPerDegree is the length of one degree of arc on the Earth's surface.
+	kmPerDegree = 111.19492664455873
+)
+
+// geoJSONFeatureCollection is the GeoJSON written by --geojson.  There is an epicentre Point feature
+// for each event and, if the preferred origin has a horizontal uncertainty, an error ellipse Polygon feature.
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	Geometry   geoJSONGeometry   `json:"geometry"`
+	Properties geoJSONProperties `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// geoJSONProperties are the WFS event properties along with the location uncertainty of the preferred origin.
+// FeatureType is epicentre or ellipse.  Lengths are in km.
+type geoJSONProperties struct {
+	wfs.Properties
+	FeatureType                     string
+	HorizontalUncertainty           float64
+	MinHorizontalUncertainty        float64
+	MaxHorizontalUncertainty        float64
+	AzimuthMaxHorizontalUncertainty float64
+	DepthUncertainty                float64
+	SemiMajorAxisLength             float64
+	SemiMinorAxisLength             float64
+	SemiIntermediateAxisLength      float64
+	MajorAxisPlunge                 float64
+	MajorAxisAzimuth                float64
+	MajorAxisRotation               float64
+}
+
+// writeGeoJSON writes a GeoJSON FeatureCollection of the quakes in props to w.
+func writeGeoJSON(w io.Writer, props []wfs.Properties, qDetails map[string]seiscompml07.Event) error {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	for _, p := range props {
+		gp := geoJSONProperties{Properties: p, FeatureType: "epicentre"}
+
+		var major, minor float64
+
+		if o := qDetails[p.PublicID].PreferredOrigin; o != nil {
+			u := o.Uncertainty
+			gp.HorizontalUncertainty = u.HorizontalUncertainty
+			gp.MinHorizontalUncertainty = u.MinHorizontalUncertainty
+			gp.MaxHorizontalUncertainty = u.MaxHorizontalUncertainty
+			gp.AzimuthMaxHorizontalUncertainty = u.AzimuthMaxHorizontalUncertainty
+			gp.DepthUncertainty = o.Depth.Uncertainty
+			gp.SemiMajorAxisLength = u.ConfidenceEllipsoid.SemiMajorAxisLength
+			gp.SemiMinorAxisLength = u.ConfidenceEllipsoid.SemiMinorAxisLength
+			gp.SemiIntermediateAxisLength = u.ConfidenceEllipsoid.SemiIntermediateAxisLength
+			gp.MajorAxisPlunge = u.ConfidenceEllipsoid.MajorAxisPlunge
+			gp.MajorAxisAzimuth = u.ConfidenceEllipsoid.MajorAxisAzimuth
+			gp.MajorAxisRotation = u.ConfidenceEllipsoid.MajorAxisRotation
+
+			// Use the horizontal ellipse if there is one, otherwise a circle.
+			major, minor = u.MaxHorizontalUncertainty, u.MinHorizontalUncertainty
+			if major == 0 {
+				major, minor = u.HorizontalUncertainty, u.HorizontalUncertainty
+			}
+		}
+
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "Point", Coordinates: []float64{p.Longitude, p.Latitude}},
+			Properties: gp,
+		})
+
+		if major > 0 {
+			gp.FeatureType = "ellipse"
+			r := ellipse(p.Longitude, p.Latitude, major, minor, gp.AzimuthMaxHorizontalUncertainty)
+			fc.Features = append(fc.Features, geoJSONFeature{
+				Type:       "Feature",
+				Geometry:   geoJSONGeometry{Type: "Polygon", Coordinates: [][][]float64{r}},
+				Properties: gp,
+			})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(fc)
+}
+
+// ellipse returns a closed counter clockwise ring of points for an ellipse centred on lon, lat
+// with semi-axes major and minor (km) and the major axis at azimuth (deg clockwise from north).
+func ellipse(lon, lat, major, minor, azimuth float64) (r [][]float64) {
+	az := azimuth * math.Pi / 180
+	kmLon := kmPerDegree * math.Cos(lat*math.Pi/180)
+
+	r = make([][]float64, ellipsePoints+1)
+
+	for i := 0; i < ellipsePoints; i++ {
+		t := 2 * math.Pi * float64(i) / float64(ellipsePoints)
+		x := major * math.Cos(t)
+		y := -minor * math.Sin(t)
+		n := x*math.Cos(az) - y*math.Sin(az)
+		e := x*math.Sin(az) + y*math.Cos(az)
+		r[i] = []float64{lon + e/kmLon, lat + n/kmPerDegree}
+	}
+	r[ellipsePoints] = r[0]
+
+	return r
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"testing"
+)
+
+func TestWriteGeoJSON(t *testing.T) {
+	props := []wfs.Properties{
+		{PublicID: "2012p070732", Latitude: -41.2897, Longitude: 174.7729},
+		{PublicID: "2014p549333", Latitude: -39.6485, Longitude: 173.4780},
+		{PublicID: "2014p562279", Latitude: -40.1, Longitude: 175.2},
+	}
+
+	o := seiscompml07.Origin{Depth: seiscompml07.Value{Uncertainty: 2.5}}
+	o.Uncertainty.HorizontalUncertainty = 1.5
+
+	// The preferred origin doesn't resolve for 2014p549333 and there are no details for 2014p562279.
+	d := map[string]seiscompml07.Event{"2012p070732": {PreferredOrigin: &o}, "2014p549333": {}}
+
+	var b bytes.Buffer
+
+	if err := writeGeoJSON(&b, props, d); err != nil {
+		t.Fatal(err)
+	}
+
+	var fc geoJSONFeatureCollection
+	if err := json.Unmarshal(b.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+
+	// An epicentre for each quake and an ellipse for the quake with a horizontal uncertainty.
+	if len(fc.Features) != 4 {
+		t.Fatal("expected 4 features, got ", len(fc.Features))
+	}
+
+	if f := fc.Features[1]; f.Geometry.Type != "Polygon" || f.Properties.DepthUncertainty != 2.5 {
+		t.Error("expected an ellipse with depth uncertainty 2.5, got ", f.Geometry.Type, f.Properties.DepthUncertainty)
+	}
+
+	if f := fc.Features[2]; f.Geometry.Type != "Point" || f.Properties.HorizontalUncertainty != 0 {
+		t.Error("expected an epicentre with no uncertainty, got ", f.Geometry.Type, f.Properties.HorizontalUncertainty)
+	}
+}
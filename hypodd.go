@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/GeoNet/qsearch/hypodd"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// writeHypoDD writes phase.dat, event.dat, and the event-ids.csv integer ID mapping table to dir.
+// The locations, errors, and travel times come from the preferred origin and the magnitude from the
+// preferred magnitude so that event.dat and phase.dat agree.  Phases that are not P or S are skipped.
+// An existing event-ids.csv in dir is reused so that IDs are stable between runs.
+func writeHypoDD(dir string, quakes []map[string]string, qDetails map[string]seiscompml07.Event) (err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	ids := make(hypodd.IDMap)
+	idFile := filepath.Join(dir, "event-ids.csv")
+
+	if f, err := os.Open(idFile); err == nil {
+		ids, err = hypodd.ReadIDMap(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Assign IDs in origin time order so that new events get increasing IDs.  Events without a
+	// preferred origin have no travel times and are not written.
+	q := make([]map[string]string, 0, len(quakes))
+	for _, v := range quakes {
+		if d, ok := qDetails[v["EventID"]]; ok && d.PreferredOrigin != nil {
+			q = append(q, v)
+		}
+	}
+	sort.Slice(q, func(i, j int) bool {
+		ti, tj := qDetails[q[i]["EventID"]].PreferredOrigin.Time.Value, qDetails[q[j]["EventID"]].PreferredOrigin.Time.Value
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return q[i]["EventID"] < q[j]["EventID"]
+	})
+
+	p := make([]string, len(q))
+	for i, v := range q {
+		p[i] = v["EventID"]
+	}
+	ids.Assign(p)
+
+	events := make([]hypodd.Event, len(q))
+
+	for i, v := range q {
+		d := qDetails[v["EventID"]]
+		o := d.PreferredOrigin
+
+		e := hypodd.Event{
+			ID:              ids[v["EventID"]],
+			PublicID:        v["EventID"],
+			Time:            o.Time.Value,
+			Latitude:        o.Latitude.Value,
+			Longitude:       o.Longitude.Value,
+			Depth:           o.Depth.Value,
+			HorizontalError: o.Uncertainty.HorizontalUncertainty,
+			DepthError:      o.Depth.Uncertainty,
+			RMS:             o.Quality.StandardError,
+		}
+
+		if d.PreferredMagnitude != nil {
+			e.Magnitude = d.PreferredMagnitude.Mag.Value
+		}
+
+		for _, a := range o.Arrivals {
+			ph, ok := hypodd.PhaseType(a.Phase)
+			if a.Pick == nil || !ok {
+				continue
+			}
+			e.Phases = append(e.Phases, hypodd.Phase{
+				StationCode: a.Pick.WaveformID.StationCode,
+				TravelTime:  a.Pick.Time.Value.Sub(o.Time.Value).Seconds(),
+				Weight:      a.TimeWeight,
+				Phase:       ph,
+			})
+		}
+
+		events[i] = e
+	}
+
+	if err = writeFile(filepath.Join(dir, "phase.dat"), func(f *os.File) error { return hypodd.WritePhase(f, events) }); err != nil {
+		return err
+	}
+
+	if err = writeFile(filepath.Join(dir, "event.dat"), func(f *os.File) error { return hypodd.WriteEvent(f, events) }); err != nil {
+		return err
+	}
+
+	return writeFile(idFile, func(f *os.File) error { return ids.Write(f) })
+}
+
+// writeFile creates the file name and writes to it with w.
+func writeFile(name string, w func(*os.File) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err = w(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
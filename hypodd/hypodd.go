@@ -0,0 +1,156 @@
+// Package hypodd writes event and phase catalogues in the formats used by
+// double-difference relocation programs such as hypoDD (ph2dt) and GrowClust.
+package hypodd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a located quake and its phases for relocation.
+type Event struct {
+	ID              int
+	PublicID        string
+	Time            time.Time
+	Latitude        float64
+	Longitude       float64
+	Depth           float64
+	Magnitude       float64
+	HorizontalError float64
+	DepthError      float64
+	RMS             float64
+	Phases          []Phase
+}
+
+// Phase is a station travel time for an Event.
+type Phase struct {
+	StationCode string
+	TravelTime  float64
+	Weight      float64
+	Phase       string
+}
+
+// IDMap maps GeoNet publicIDs to the integer event IDs required by hypoDD.
+type IDMap map[string]int
+
+// ReadIDMap reads a mapping table written by IDMap.Write.
+func ReadIDMap(r io.Reader) (m IDMap, err error) {
+	m = make(IDMap)
+
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		if len(row) != 2 {
+			return nil, errors.New(fmt.Sprintf("Expected 2 columns on line %d, got %d", i+1, len(row)))
+		}
+		// header line.
+		if i == 0 && row[0] == "ID" {
+			continue
+		}
+		id, err := strconv.Atoi(row[0])
+		if err != nil {
+			return nil, err
+		}
+		m[row[1]] = id
+	}
+
+	return m, nil
+}
+
+// Assign gives an integer ID to each publicID that does not already have one.
+// New IDs follow on from the largest ID in the map and are assigned in the order
+// the publicIDs are given so that IDs are stable between runs.
+func (m IDMap) Assign(publicIDs []string) {
+	next := 0
+	for _, id := range m {
+		if id > next {
+			next = id
+		}
+	}
+
+	for _, p := range publicIDs {
+		if _, ok := m[p]; !ok {
+			next++
+			m[p] = next
+		}
+	}
+}
+
+// Write writes the mapping table as CSV, ordered by integer ID.
+func (m IDMap) Write(w io.Writer) error {
+	p := make([]string, 0, len(m))
+	for k := range m {
+		p = append(p, k)
+	}
+	sort.Slice(p, func(i, j int) bool { return m[p[i]] < m[p[j]] })
+
+	c := csv.NewWriter(w)
+	c.Write([]string{"ID", "EventID"})
+	for _, k := range p {
+		c.Write([]string{strconv.Itoa(m[k]), k})
+	}
+	c.Flush()
+
+	return c.Error()
+}
+
+// WritePhase writes events in the ph2dt phase.dat format.  Each event is a '#' line
+// followed by one line per phase with the station, travel time (s), weight, and phase.
+func WritePhase(w io.Writer, events []Event) error {
+	b := bufio.NewWriter(w)
+
+	for _, e := range events {
+		t := e.Time.UTC()
+		fmt.Fprintf(b, "# %4d %2d %2d %2d %2d %5.2f %8.4f %9.4f %7.2f %5.2f %6.2f %6.2f %5.2f %9d\n",
+			t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), seconds(t),
+			e.Latitude, e.Longitude, e.Depth, e.Magnitude, e.HorizontalError, e.DepthError, e.RMS, e.ID)
+		for _, p := range e.Phases {
+			fmt.Fprintf(b, "%-7s %8.3f %6.3f %s\n", p.StationCode, p.TravelTime, p.Weight, p.Phase)
+		}
+	}
+
+	return b.Flush()
+}
+
+// WriteEvent writes events in the hypoDD event.dat format.
+func WriteEvent(w io.Writer, events []Event) error {
+	b := bufio.NewWriter(w)
+
+	for _, e := range events {
+		t := e.Time.UTC()
+		fmt.Fprintf(b, "%s  %02d%02d%04d  %8.4f  %9.4f  %8.3f  %4.1f  %7.2f  %7.2f  %5.2f  %9d\n",
+			t.Format("20060102"), t.Hour(), t.Minute(), int(seconds(t)*100),
+			e.Latitude, e.Longitude, e.Depth, e.Magnitude, e.HorizontalError, e.DepthError, e.RMS, e.ID)
+	}
+
+	return b.Flush()
+}
+
+// PhaseType returns P or S for phase as ph2dt only has P and S phases.  Phases starting with P,
+// e.g., Pn and PKP, are P and phases starting with S, e.g., Sg, are S.  ok is false for other phases,
+// including depth phases such as pP, which should be skipped.
+func PhaseType(phase string) (t string, ok bool) {
+	switch {
+	case strings.HasPrefix(phase, "P"):
+		return "P", true
+	case strings.HasPrefix(phase, "S"):
+		return "S", true
+	}
+
+	return "", false
+}
+
+// seconds returns the seconds of the minute including the fractional part.
+func seconds(t time.Time) float64 {
+	return float64(t.Second()) + float64(t.Nanosecond())/1e9
+}
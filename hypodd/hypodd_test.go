@@ -0,0 +1,101 @@
+package hypodd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePhase(t *testing.T) {
+	ot, _ := time.Parse(time.RFC3339Nano, "2012-01-27T04:06:25.369465Z")
+
+	e := []Event{{
+		ID:        1,
+		PublicID:  "2012p070732",
+		Time:      ot,
+		Latitude:  -41.2897,
+		Longitude: 174.7729,
+		Depth:     12.5,
+		Magnitude: 2.65,
+		RMS:       0.21,
+		Phases:    []Phase{{StationCode: "WVZ", TravelTime: 4.428928, Weight: 1.0, Phase: "P"}},
+	}}
+
+	var b bytes.Buffer
+	err := WritePhase(&b, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := strings.Split(b.String(), "\n")
+
+	if l[0] != "# 2012  1 27  4  6 25.37 -41.2897  174.7729   12.50  2.65   0.00   0.00  0.21         1" {
+		t.Error("incorrect event line, got", l[0])
+	}
+	if l[1] != "WVZ        4.429  1.000 P" {
+		t.Error("incorrect phase line, got", l[1])
+	}
+
+	b.Reset()
+	err = WriteEvent(&b, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "20120127  04062536  -41.2897   174.7729    12.500   2.6     0.00     0.00   0.21          1\n" {
+		t.Error("incorrect event.dat line, got", b.String())
+	}
+}
+
+func TestIDMap(t *testing.T) {
+	m, err := ReadIDMap(strings.NewReader("ID,EventID\n1,2012p070732\n7,2014p549333\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Assign([]string{"2014p549333", "2014p562279", "2012p070732"})
+
+	if m["2012p070732"] != 1 {
+		t.Error("2012p070732 expected 1, got ", m["2012p070732"])
+	}
+	if m["2014p549333"] != 7 {
+		t.Error("2014p549333 expected 7, got ", m["2014p549333"])
+	}
+	if m["2014p562279"] != 8 {
+		t.Error("2014p562279 expected 8, got ", m["2014p562279"])
+	}
+
+	var b bytes.Buffer
+	err = m.Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "ID,EventID\n1,2012p070732\n7,2014p549333\n8,2014p562279\n" {
+		t.Error("incorrect id map, got", b.String())
+	}
+}
+
+func TestPhaseType(t *testing.T) {
+	for _, v := range []struct {
+		phase, t string
+		ok       bool
+	}{
+		{"P", "P", true},
+		{"Pn", "P", true},
+		{"Pg", "P", true},
+		{"PKP", "P", true},
+		{"S", "S", true},
+		{"Sg", "S", true},
+		{"Sn", "S", true},
+		{"pP", "", false},
+		{"sP", "", false},
+		{"Lg", "", false},
+		{"", "", false},
+	} {
+		if p, ok := PhaseType(v.phase); p != v.t || ok != v.ok {
+			t.Errorf("PhaseType(%q) expected %q %t, got %q %t", v.phase, v.t, v.ok, p, ok)
+		}
+	}
+}
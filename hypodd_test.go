@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHypoDD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ot, _ := time.Parse(time.RFC3339Nano, "2012-01-27T04:06:25.369465Z")
+
+	// The WFS values differ from the details and are not used.
+	quakes := []map[string]string{
+		{"EventID": "2012p070732", "Latitude": "-40", "Longitude": "170", "Depth": "99", "Magnitude": "5", "OriginError": "0.9"},
+		// No details so not written.
+		{"EventID": "2014p549333", "Latitude": "-39.6485", "Longitude": "173.4780", "Depth": "7.3", "Magnitude": "2.64", "OriginError": "0.3"},
+		// No preferred origin so not written.
+		{"EventID": "2014p562279", "Latitude": "-40.1", "Longitude": "175.2", "Depth": "20.1", "Magnitude": "3.1", "OriginError": "0.4"},
+	}
+
+	pick := func(s float64) *seiscompml07.Pick {
+		return &seiscompml07.Pick{
+			WaveformID: seiscompml07.WaveformID{StationCode: "WVZ"},
+			Time:       seiscompml07.TimeValue{Value: ot.Add(time.Duration(s * float64(time.Second)))},
+		}
+	}
+
+	o := seiscompml07.Origin{
+		Time:      seiscompml07.TimeValue{Value: ot},
+		Latitude:  seiscompml07.Value{Value: -41.2897},
+		Longitude: seiscompml07.Value{Value: 174.7729},
+		Depth:     seiscompml07.Value{Value: 12.5, Uncertainty: 3.25},
+		Quality:   seiscompml07.Quality{StandardError: 0.21},
+		Arrivals: []seiscompml07.Arrival{
+			{Phase: "P", Pick: pick(4), TimeWeight: 1},
+			{Phase: "Pn", Pick: pick(5), TimeWeight: 1},
+			{Phase: "Sg", Pick: pick(7), TimeWeight: 0.5},
+			// Not P or S so skipped.
+			{Phase: "pP", Pick: pick(8), TimeWeight: 1},
+			{Phase: "Lg", Pick: pick(9), TimeWeight: 1},
+		},
+	}
+
+	m := seiscompml07.Magnitude{Mag: seiscompml07.Mag{Value: 2.65}}
+
+	d := map[string]seiscompml07.Event{"2012p070732": {PreferredOrigin: &o, PreferredMagnitude: &m}, "2014p562279": {}}
+
+	if err = writeHypoDD(dir, quakes, d); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "event.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := strings.Split(strings.TrimSpace(string(b)), "\n")
+
+	if len(l) != 1 {
+		t.Fatal("expected 1 event, got ", len(l))
+	}
+
+	// The location, errors, and magnitude come from the preferred origin and magnitude.
+	if l[0] != "20120127  04062536  -41.2897   174.7729    12.500   2.6     0.00     3.25   0.21          1" {
+		t.Error("incorrect event.dat line, got ", l[0])
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, "phase.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l = strings.Split(strings.TrimSpace(string(b)), "\n")
+
+	if len(l) != 4 {
+		t.Fatal("expected an event line and 3 phases, got ", l)
+	}
+
+	if f := strings.Fields(l[0]); len(f) != 15 || f[7] != "-41.2897" || f[10] != "2.65" || f[12] != "3.25" || f[13] != "0.21" {
+		t.Error("incorrect phase.dat event line, got ", l[0])
+	}
+
+	for i, v := range []string{"WVZ        4.000  1.000 P", "WVZ        5.000  1.000 P", "WVZ        7.000  0.500 S"} {
+		if l[i+1] != v {
+			t.Errorf("phase line expected %q, got %q", v, l[i+1])
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GeoNet/qsearch/fdsnevent"
+	"github.com/GeoNet/qsearch/progress"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The logging levels set by --quiet and --verbose.  Warnings and errors are always logged.
+const (
+	levelQuiet = iota
+	levelInfo
+	levelVerbose
+)
+
+// barWidth is the number of characters in the progress bar.
+const barWidth = 30
+
+var (
+	logLevel = levelInfo
+	logJSON  bool
+	// progressBar is true if the progress of fetching quake details is shown as a progress bar.
+	progressBar bool
+	// logMu serialises writes to stderr so that log lines and the progress bar don't interleave.
+	logMu sync.Mutex
+	bar   barState
+)
+
+// barState is the progress bar that is being drawn.
+type barState struct {
+	start time.Time
+	drawn time.Time
+	shown bool
+}
+
+// setLogging sets the logging level and format and sends the progress of searches to reportProgress.
+// The progress bar is used for the info level if stderr is a terminal.
+func setLogging(quiet, verbose bool, format string) error {
+	switch {
+	case quiet && verbose:
+		return errors.New("--quiet and --verbose can't be used together")
+	case quiet:
+		logLevel = levelQuiet
+	case verbose:
+		logLevel = levelVerbose
+	default:
+		logLevel = levelInfo
+	}
+
+	switch format {
+	case "text":
+		logJSON = false
+		log.SetOutput(textLogWriter{})
+	case "json":
+		logJSON = true
+		// Messages logged directly with the log package are errors.
+		log.SetFlags(0)
+		log.SetOutput(jsonLogWriter{})
+	default:
+		return fmt.Errorf("invalid --log-format %s", format)
+	}
+
+	progressBar = !logJSON && logLevel == levelInfo && isTerminal(os.Stderr)
+
+	wfs.Progress = reportProgress
+	fdsnevent.Progress = reportProgress
+	seiscompml07.Progress = reportProgress
+
+	return nil
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// infof logs an informational message unless --quiet is used.
+func infof(format string, v ...interface{}) {
+	logEvent("info", fmt.Sprintf(format, v...), nil)
+}
+
+// warnf logs a warning.
+func warnf(format string, v ...interface{}) {
+	logEvent("warning", fmt.Sprintf(format, v...), nil)
+}
+
+// logEvent logs msg at level; debug, info, warning, or error.  debug is only logged with --verbose
+// and info is not logged with --quiet.  The fields are only logged for --log-format json.
+func logEvent(level, msg string, fields map[string]interface{}) {
+	switch {
+	case level == "debug" && logLevel < levelVerbose:
+		return
+	case level == "info" && logLevel < levelInfo:
+		return
+	}
+
+	if logJSON {
+		writeJSONLog(level, msg, fields)
+		return
+	}
+
+	log.Print(msg)
+}
+
+// writeJSONLog writes a JSON log line with the time, level, msg, and fields to stderr.
+func writeJSONLog(level, msg string, fields map[string]interface{}) {
+	m := map[string]interface{}{
+		"time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"level": level,
+		"msg":   msg,
+	}
+	for k, v := range fields {
+		m[k] = v
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		b = []byte(fmt.Sprintf(`{"level":"error","msg":%q}`, err.Error()))
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	os.Stderr.Write(append(b, '\n'))
+}
+
+// jsonLogWriter writes the messages from the log package as JSON errors.
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(p []byte) (int, error) {
+	writeJSONLog("error", strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
+
+// textLogWriter writes the messages from the log package to stderr after clearing the progress bar.
+type textLogWriter struct{}
+
+func (textLogWriter) Write(p []byte) (int, error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	clearBar()
+	return os.Stderr.Write(p)
+}
+
+// reportProgress logs the progress of searches and of fetching quake details.  The URLs that are
+// fetched are only logged with --verbose.  On a terminal the progress of fetching quake details is
+// shown as a progress bar with the estimated time to finish.
+func reportProgress(e progress.Event) {
+	fields := map[string]interface{}{"source": e.Source, "kind": e.Kind}
+	if e.URL != "" {
+		fields["url"] = e.URL
+	}
+	if e.EventID != "" {
+		fields["eventid"] = e.EventID
+	}
+	if e.Kind == progress.Quakes || e.Kind == progress.Error {
+		fields["done"] = e.Done
+		if e.Total > 0 {
+			fields["total"] = e.Total
+		}
+	}
+	if e.Err != nil {
+		fields["error"] = e.Err.Error()
+	}
+
+	switch e.Kind {
+	case progress.Request:
+		logEvent("debug", e.URL, fields)
+	case progress.Warning:
+		logEvent("warning", e.Err.Error(), fields)
+	case progress.Error:
+		logEvent("error", fmt.Sprintf("Error fetching data for %s: %v", e.EventID, e.Err), fields)
+	}
+
+	if e.Kind != progress.Quakes && e.Kind != progress.Error {
+		return
+	}
+
+	switch {
+	case progressBar && e.Total > 0:
+		drawBar(e)
+	case logLevel == levelVerbose && e.EventID != "":
+		logEvent("debug", fmt.Sprintf("Downloaded %s (%d of %d)", e.EventID, e.Done, e.Total), fields)
+	case e.Kind == progress.Quakes && progress.Due(e):
+		logEvent("info", fmt.Sprintf("Downloaded %v quakes", e.Done), fields)
+	}
+}
+
+// drawBar draws the progress bar for e on stderr.  The bar is redrawn at most every 100 ms and ends
+// with a new line when the download is finished.
+func drawBar(e progress.Event) {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	now := time.Now()
+
+	if e.Done <= 1 || bar.start.IsZero() {
+		bar.start = now
+	}
+
+	if e.Done < e.Total && now.Sub(bar.drawn) < 100*time.Millisecond {
+		return
+	}
+
+	n := barWidth * e.Done / e.Total
+
+	eta := "--"
+	if e.Done > 0 {
+		eta = (now.Sub(bar.start) * time.Duration(e.Total-e.Done) / time.Duration(e.Done)).Round(time.Second).String()
+	}
+
+	fmt.Fprintf(os.Stderr, "\rquake details [%-*s] %d/%d %3d%% ETA %s\033[K",
+		barWidth, strings.Repeat("=", n), e.Done, e.Total, 100*e.Done/e.Total, eta)
+
+	bar.drawn = now
+	bar.shown = true
+
+	if e.Done >= e.Total {
+		fmt.Fprintln(os.Stderr)
+		bar = barState{}
+	}
+}
+
+// clearBar clears the progress bar so a log line can be written.  It is redrawn with the next progress.
+func clearBar() {
+	if bar.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		bar.shown = false
+		bar.drawn = time.Time{}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"github.com/GeoNet/qsearch/parquet"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// The Parquet column types for the format keys.  Keys that are not listed are strings.
+var (
+	eventTypes = map[string]parquet.Type{
+		"OriginTime":            parquet.Time,
+		"ModificationTime":      parquet.Time,
+		"Latitude":              parquet.Float,
+		"Longitude":             parquet.Float,
+		"Depth":                 parquet.Float,
+		"Magnitude":             parquet.Float,
+		"OriginError":           parquet.Float,
+		"UsedPhaseCount":        parquet.Int,
+		"UsedStationCount":      parquet.Int,
+		"MinimumDistance":       parquet.Float,
+		"AzimuthalGap":          parquet.Float,
+		"MagnitudeUncertainty":  parquet.Float,
+		"MagnitudeStationCount": parquet.Int,
+	}
+
+	originTypes = map[string]parquet.Type{
+		"OriginTime":                      parquet.Time,
+		"Latitude":                        parquet.Float,
+		"LatitudeUncertainty":             parquet.Float,
+		"Longitude":                       parquet.Float,
+		"LongitudeUncertainty":            parquet.Float,
+		"Depth":                           parquet.Float,
+		"DepthUncertainty":                parquet.Float,
+		"AssociatedPhaseCount":            parquet.Int,
+		"UsedPhaseCount":                  parquet.Int,
+		"AssociatedStationCount":          parquet.Int,
+		"UsedStationCount":                parquet.Int,
+		"StandardError":                   parquet.Float,
+		"AzimuthalGap":                    parquet.Float,
+		"SecondaryAzimuthalGap":           parquet.Float,
+		"MinimumDistance":                 parquet.Float,
+		"MedianDistance":                  parquet.Float,
+		"MaximumDistance":                 parquet.Float,
+		"HorizontalUncertainty":           parquet.Float,
+		"MinHorizontalUncertainty":        parquet.Float,
+		"MaxHorizontalUncertainty":        parquet.Float,
+		"AzimuthMaxHorizontalUncertainty": parquet.Float,
+		"SemiMajorAxisLength":             parquet.Float,
+		"SemiMinorAxisLength":             parquet.Float,
+		"SemiIntermediateAxisLength":      parquet.Float,
+		"MajorAxisPlunge":                 parquet.Float,
+		"MajorAxisAzimuth":                parquet.Float,
+		"MajorAxisRotation":               parquet.Float,
+		"ConfidenceLevel":                 parquet.Float,
+		"CreationTime":                    parquet.Time,
+		"ModificationTime":                parquet.Time,
+	}
+
+	magnitudeTypes = map[string]parquet.Type{
+		"Magnitude":        parquet.Float,
+		"Uncertainty":      parquet.Float,
+		"StationCount":     parquet.Int,
+		"CreationTime":     parquet.Time,
+		"ModificationTime": parquet.Time,
+	}
+
+	stationMagnitudeTypes = map[string]parquet.Type{
+		"Magnitude":        parquet.Float,
+		"StationMagnitude": parquet.Float,
+		"Residual":         parquet.Float,
+		"Weight":           parquet.Float,
+		"Amplitude":        parquet.Float,
+		"Period":           parquet.Float,
+		"CreationTime":     parquet.Time,
+		"ModificationTime": parquet.Time,
+	}
+
+	amplitudeTypes = map[string]parquet.Type{
+		"Amplitude":           parquet.Float,
+		"Uncertainty":         parquet.Float,
+		"Period":              parquet.Float,
+		"SNR":                 parquet.Float,
+		"TimeWindowReference": parquet.Time,
+		"TimeWindowBegin":     parquet.Float,
+		"TimeWindowEnd":       parquet.Float,
+		"PhaseTime":           parquet.Time,
+		"CreationTime":        parquet.Time,
+		"ModificationTime":    parquet.Time,
+	}
+
+	focalMechanismTypes = map[string]parquet.Type{
+		"Strike1":              parquet.Float,
+		"Dip1":                 parquet.Float,
+		"Rake1":                parquet.Float,
+		"Strike2":              parquet.Float,
+		"Dip2":                 parquet.Float,
+		"Rake2":                parquet.Float,
+		"PreferredPlane":       parquet.Int,
+		"TAxisAzimuth":         parquet.Float,
+		"TAxisPlunge":          parquet.Float,
+		"TAxisLength":          parquet.Float,
+		"PAxisAzimuth":         parquet.Float,
+		"PAxisPlunge":          parquet.Float,
+		"PAxisLength":          parquet.Float,
+		"NAxisAzimuth":         parquet.Float,
+		"NAxisPlunge":          parquet.Float,
+		"NAxisLength":          parquet.Float,
+		"AzimuthalGap":         parquet.Float,
+		"StationPolarityCount": parquet.Int,
+		"Misfit":               parquet.Float,
+		"Mw":                   parquet.Float,
+		"ScalarMoment":         parquet.Float,
+		"Mrr":                  parquet.Float,
+		"Mtt":                  parquet.Float,
+		"Mpp":                  parquet.Float,
+		"Mrt":                  parquet.Float,
+		"Mrp":                  parquet.Float,
+		"Mtp":                  parquet.Float,
+		"VarianceReduction":    parquet.Float,
+		"DoubleCouple":         parquet.Float,
+		"CLVD":                 parquet.Float,
+		"CreationTime":         parquet.Time,
+		"ModificationTime":     parquet.Time,
+	}
+
+	pickTypes = map[string]parquet.Type{
+		"PhaseTime":                     parquet.Time,
+		"TimeUncertainty":               parquet.Float,
+		"TimeLowerUncertainty":          parquet.Float,
+		"TimeUpperUncertainty":          parquet.Float,
+		"Backazimuth":                   parquet.Float,
+		"BackazimuthUncertainty":        parquet.Float,
+		"HorizontalSlowness":            parquet.Float,
+		"HorizontalSlownessUncertainty": parquet.Float,
+		"CreationTime":                  parquet.Time,
+		"ModificationTime":              parquet.Time,
+	}
+
+	arrivalTypes = map[string]parquet.Type{
+		"PhaseTime":                  parquet.Time,
+		"PhaseOriginOffset":          parquet.Float,
+		"TimeCorrection":             parquet.Float,
+		"TakeoffAngle":               parquet.Float,
+		"TimeResidual":               parquet.Float,
+		"HorizontalSlownessResidual": parquet.Float,
+		"BackazimuthResidual":        parquet.Float,
+		"TimeWeight":                 parquet.Float,
+		"HorizontalSlownessWeight":   parquet.Float,
+		"BackazimuthWeight":          parquet.Float,
+		"Azimuth":                    parquet.Float,
+		"Distance":                   parquet.Float,
+		"CreationTime":               parquet.Time,
+		"ModificationTime":           parquet.Time,
+	}
+)
+
+// writeParquet writes the columns oF from rows to the Parquet file name.  Values that
+// are empty or can't be parsed as the column type are written as null.
+func writeParquet(name string, oF []string, rows []map[string]string, types map[string]parquet.Type) (err error) {
+	c := make([]parquet.Column, len(oF))
+	for i, n := range oF {
+		c[i] = parquet.Column{Name: n, Type: types[n]}
+	}
+
+	t := parquet.NewTable(c)
+	o := make([]interface{}, len(oF))
+
+	for _, v := range rows {
+		for i, n := range oF {
+			o[i] = typed(v[n], c[i].Type)
+		}
+		if err = t.Append(o); err != nil {
+			return err
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	return writeFile(name, func(f *os.File) error { return t.Write(f) })
+}
+
+// typed converts s to the Go type for the column type t or nil if this is not possible.
+func typed(s string, t parquet.Type) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	switch t {
+	case parquet.Int:
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return v
+		}
+	case parquet.Float:
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case parquet.Time:
+		if v, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return v
+		}
+	default:
+		return s
+	}
+
+	return nil
+}
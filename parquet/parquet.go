@@ -0,0 +1,288 @@
+// Package parquet writes tables of typed columns as Apache Parquet files.
+//
+// Only what is needed for exporting quake catalogues is supported: flat schemas of optional
+// string, int64, double, and timestamp columns written as a single row group with one
+// PLAIN encoded, uncompressed, data page per column.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	String Type = iota // UTF8 BYTE_ARRAY
+	Int                // INT64
+	Float              // DOUBLE
+	Time               // INT64 TIMESTAMP_MICROS
+)
+
+// Column describes a column in the table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Parquet physical types, converted types, and encodings.
+const (
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	repetitionOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageData = 0
+
+	codecUncompressed = 0
+)
+
+const magic = "PAR1"
+
+// Table holds rows in columnar form until they are written.
+type Table struct {
+	cols    []Column
+	data    []*bytes.Buffer
+	defined [][]bool
+	rows    int
+}
+
+// NewTable returns an empty Table with the columns c.
+func NewTable(c []Column) *Table {
+	t := &Table{cols: c, data: make([]*bytes.Buffer, len(c)), defined: make([][]bool, len(c))}
+	for i := range t.data {
+		t.data[i] = &bytes.Buffer{}
+	}
+	return t
+}
+
+// Append adds a row to the table.  The values must be in column order and of type
+// string, int64, float64, or time.Time to match the column types.  A nil value is null.
+func (t *Table) Append(row []interface{}) error {
+	if len(row) != len(t.cols) {
+		return errors.New(fmt.Sprintf("Expected %d values, got %d", len(t.cols), len(row)))
+	}
+
+	for i, c := range t.cols {
+		if row[i] == nil {
+			continue
+		}
+
+		var ok bool
+		b := t.data[i]
+
+		switch c.Type {
+		case String:
+			var v string
+			if v, ok = row[i].(string); ok {
+				binary.Write(b, binary.LittleEndian, uint32(len(v)))
+				b.WriteString(v)
+			}
+		case Int:
+			var v int64
+			if v, ok = row[i].(int64); ok {
+				binary.Write(b, binary.LittleEndian, v)
+			}
+		case Float:
+			var v float64
+			if v, ok = row[i].(float64); ok {
+				binary.Write(b, binary.LittleEndian, math.Float64bits(v))
+			}
+		case Time:
+			var v time.Time
+			if v, ok = row[i].(time.Time); ok {
+				binary.Write(b, binary.LittleEndian, v.UnixNano()/1000)
+			}
+		}
+
+		if !ok {
+			return errors.New(fmt.Sprintf("Wrong type %T for column %s", row[i], c.Name))
+		}
+	}
+
+	for i := range t.cols {
+		t.defined[i] = append(t.defined[i], row[i] != nil)
+	}
+
+	t.rows++
+
+	return nil
+}
+
+// Rows returns the number of rows in the table.
+func (t *Table) Rows() int {
+	return t.rows
+}
+
+// Write writes the table to w as a Parquet file.
+func (t *Table) Write(w io.Writer) error {
+	cw := &counter{w: w}
+	cw.Write([]byte(magic))
+
+	var chunks []columnChunk
+	var total int64
+
+	for i, c := range t.cols {
+		d := levels(t.defined[i])
+		n := len(d) + t.data[i].Len()
+
+		var h thrift
+		h.i32(1, pageData)
+		h.i32(2, int32(n))
+		h.i32(3, int32(n))
+		h.begin(5)
+		h.i32(1, int32(t.rows))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.end()
+		h.end()
+
+		cc := columnChunk{
+			name:   c.Name,
+			typ:    physical(c.Type),
+			offset: cw.n,
+			size:   int64(h.Len() + n),
+		}
+		chunks = append(chunks, cc)
+		total += cc.size
+
+		cw.Write(h.Bytes())
+		cw.Write(d)
+		cw.Write(t.data[i].Bytes())
+	}
+
+	var m thrift
+	m.i32(1, 1)
+
+	m.list(2, structType, len(t.cols)+1)
+	m.elem()
+	m.str(4, "schema")
+	m.i32(5, int32(len(t.cols)))
+	m.end()
+	for _, c := range t.cols {
+		m.elem()
+		m.i32(1, physical(c.Type))
+		m.i32(3, repetitionOptional)
+		m.str(4, c.Name)
+		switch c.Type {
+		case String:
+			m.i32(6, convertedUTF8)
+		case Time:
+			m.i32(6, convertedTimestampMicros)
+		}
+		m.end()
+	}
+
+	m.i64(3, int64(t.rows))
+
+	m.list(4, structType, 1)
+	m.elem()
+	m.list(1, structType, len(chunks))
+	for _, cc := range chunks {
+		m.elem()
+		m.i64(2, cc.offset)
+		m.begin(3)
+		m.i32(1, cc.typ)
+		m.list(2, i32Type, 2)
+		m.i32Elem(encodingPlain)
+		m.i32Elem(encodingRLE)
+		m.list(3, binaryType, 1)
+		m.binary(cc.name)
+		m.i32(4, codecUncompressed)
+		m.i64(5, int64(t.rows))
+		m.i64(6, cc.size)
+		m.i64(7, cc.size)
+		m.i64(9, cc.offset)
+		m.end()
+		m.end()
+	}
+	m.i64(2, total)
+	m.i64(3, int64(t.rows))
+	m.end()
+
+	m.str(6, "qsearch")
+	m.end()
+
+	cw.Write(m.Bytes())
+	binary.Write(cw, binary.LittleEndian, uint32(m.Len()))
+	cw.Write([]byte(magic))
+
+	return cw.err
+}
+
+// counter counts the bytes written to w so that file offsets can be recorded.
+// Writing stops at the first error.
+type counter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+// levels encodes the definition levels for an optional column using the
+// RLE/bit-packing hybrid encoding (as RLE runs only) with a 4 byte length prefix.
+func levels(defined []bool) []byte {
+	var r bytes.Buffer
+	v := make([]byte, binary.MaxVarintLen64)
+
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		r.Write(v[:binary.PutUvarint(v, uint64(j-i)<<1)])
+		if defined[i] {
+			r.WriteByte(1)
+		} else {
+			r.WriteByte(0)
+		}
+		i = j
+	}
+
+	b := make([]byte, 4, 4+r.Len())
+	binary.LittleEndian.PutUint32(b, uint32(r.Len()))
+
+	return append(b, r.Bytes()...)
+}
+
+// columnChunk is used to build the file metadata after the column data has been written.
+type columnChunk struct {
+	name   string
+	typ    int32
+	offset int64
+	size   int64
+}
+
+func physical(t Type) int32 {
+	switch t {
+	case Int, Time:
+		return typeInt64
+	case Float:
+		return typeDouble
+	default:
+		return typeByteArray
+	}
+}
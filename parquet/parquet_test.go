@@ -0,0 +1,78 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	ot, _ := time.Parse(time.RFC3339Nano, "2012-01-27T04:06:25.369465Z")
+
+	tb := NewTable([]Column{
+		{Name: "EventID", Type: String},
+		{Name: "OriginTime", Type: Time},
+		{Name: "Magnitude", Type: Float},
+		{Name: "UsedPhaseCount", Type: Int},
+	})
+
+	err := tb.Append([]interface{}{"2012p070732", ot, 2.652616042, int64(23)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tb.Append([]interface{}{"2014p549333", ot, nil, int64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tb.Append([]interface{}{"2014p549333", ot, "2.6", int64(7)})
+	if err == nil {
+		t.Error("expected an error for wrong type")
+	}
+
+	err = tb.Append([]interface{}{"2014p549333"})
+	if err == nil {
+		t.Error("expected an error for wrong number of values")
+	}
+
+	if tb.Rows() != 2 {
+		t.Error("expected 2 rows, got ", tb.Rows())
+	}
+
+	var b bytes.Buffer
+	err = tb.Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := b.Bytes()
+
+	if string(f[:4]) != "PAR1" || string(f[len(f)-4:]) != "PAR1" {
+		t.Error("missing PAR1 magic")
+	}
+
+	m := int(binary.LittleEndian.Uint32(f[len(f)-8:]))
+	if m <= 0 || m > len(f)-12 {
+		t.Error("incorrect footer length ", m)
+	}
+
+	if !bytes.Contains(f, []byte{11, 0, 0, 0, '2', '0', '1', '2', 'p', '0', '7', '0', '7', '3', '2'}) {
+		t.Error("missing PLAIN encoded EventID")
+	}
+
+	us := make([]byte, 8)
+	binary.LittleEndian.PutUint64(us, uint64(ot.UnixNano()/1000))
+	if !bytes.Contains(f, us) {
+		t.Error("missing PLAIN encoded OriginTime")
+	}
+}
+
+func TestLevels(t *testing.T) {
+	l := levels([]bool{true, true, false, true})
+
+	if !bytes.Equal(l, []byte{6, 0, 0, 0, 4, 1, 2, 0, 2, 1}) {
+		t.Errorf("incorrect levels, got %v", l)
+	}
+}
@@ -0,0 +1,105 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol types.
+const (
+	i32Type    = 5
+	i64Type    = 6
+	binaryType = 8
+	listType   = 9
+	structType = 12
+)
+
+// thrift encodes structs using the Thrift compact protocol which is used
+// for the Parquet page headers and file metadata.  Structs are opened with begin
+// (a struct field) or elem (a struct in a list) and closed with end.  The top level
+// struct is open from the start and must also be closed with end.
+type thrift struct {
+	bytes.Buffer
+	last []int16 // the last field id written in each open struct.
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+
+	l := &t.last[len(t.last)-1]
+
+	if d := id - *l; d > 0 && d <= 15 {
+		t.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+
+	*l = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, i32Type)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, i64Type)
+	t.varint(zigzag(v))
+}
+
+func (t *thrift) str(id int16, v string) {
+	t.field(id, binaryType)
+	t.binary(v)
+}
+
+// list writes the header for a list of n elements of type typ.  The elements
+// follow with elem, binary, or i32Elem.
+func (t *thrift) list(id int16, typ byte, n int) {
+	t.field(id, listType)
+	if n < 15 {
+		t.WriteByte(byte(n)<<4 | typ)
+	} else {
+		t.WriteByte(0xf0 | typ)
+		t.varint(uint64(n))
+	}
+}
+
+func (t *thrift) begin(id int16) {
+	t.field(id, structType)
+	t.last = append(t.last, 0)
+}
+
+func (t *thrift) elem() {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+	t.last = append(t.last, 0)
+}
+
+func (t *thrift) end() {
+	t.WriteByte(0)
+	if len(t.last) > 0 {
+		t.last = t.last[:len(t.last)-1]
+	}
+}
+
+func (t *thrift) binary(v string) {
+	t.varint(uint64(len(v)))
+	t.WriteString(v)
+}
+
+func (t *thrift) i32Elem(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) varint(v uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	t.Write(b[:binary.PutUvarint(b, v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
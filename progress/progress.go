@@ -0,0 +1,62 @@
+// Package progress reports the progress of searching for quakes and fetching quake details.  The
+// packages that search or fetch have a Progress variable that is called with each Event.
+package progress
+
+import (
+	"log"
+)
+
+// The kinds of Event.
+const (
+	// Request is sent when a URL has been fetched.
+	Request = "request"
+	// Quakes is sent when quakes have been downloaded.  Done is the number so far.
+	Quakes = "quakes"
+	// Warning is sent for errors that don't stop the search e.g., failing to cache a document.
+	Warning = "warning"
+	// Error is sent when the details for a quake can't be fetched.  The quake is counted in Done.
+	Error = "error"
+)
+
+// logEvery is how often Log logs the progress of downloads with a known total.
+const logEvery = 50
+
+// Event is the progress of a search or a download.  Source is the package that sent the event
+// e.g., wfs.  Total is the number of quakes that will be downloaded or 0 if it is not known.
+type Event struct {
+	Source  string
+	Kind    string
+	URL     string
+	EventID string
+	Done    int
+	Total   int
+	Err     error
+}
+
+// Func is called with progress events.  The events for a search are sent one at a time but searches
+// that run at the same time can call it concurrently.
+type Func func(e Event)
+
+// Log logs e with the standard logger.  Downloads with a known total are logged every 50 quakes and
+// when they are finished.
+func Log(e Event) {
+	switch e.Kind {
+	case Request:
+		log.Print(e.URL)
+	case Quakes:
+		if Due(e) {
+			log.Printf("Downloaded %v quakes", e.Done)
+		}
+	case Warning:
+		log.Println(e.Err)
+	case Error:
+		log.Println("Error fetching data for " + e.EventID)
+		log.Println(e.Err)
+	}
+}
+
+// Due returns true if the progress of e should be logged.  This is for every Quakes event if the
+// total is not known, otherwise every 50 quakes and the last.
+func Due(e Event) bool {
+	return e.Kind == Quakes && (e.Total == 0 || e.Done%logEvery == 0 || e.Done == e.Total)
+}
@@ -0,0 +1,23 @@
+package progress
+
+import (
+	"testing"
+)
+
+func TestDue(t *testing.T) {
+	for _, c := range []struct {
+		e   Event
+		due bool
+	}{
+		{Event{Kind: Quakes, Done: 7}, true},
+		{Event{Kind: Quakes, Done: 7, Total: 120}, false},
+		{Event{Kind: Quakes, Done: 50, Total: 120}, true},
+		{Event{Kind: Quakes, Done: 120, Total: 120}, true},
+		{Event{Kind: Request, URL: "http://example.org"}, false},
+		{Event{Kind: Error, Done: 50, Total: 120}, false},
+	} {
+		if Due(c.e) != c.due {
+			t.Errorf("Due expected %v for %+v", c.due, c.e)
+		}
+	}
+}
@@ -1,111 +1,676 @@
 package main
 
 import (
+	"bufio"
+	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/GeoNet/qsearch/fdsnevent"
+	"github.com/GeoNet/qsearch/parquet"
 	"github.com/GeoNet/qsearch/seiscompml07"
 	"github.com/GeoNet/qsearch/wfs"
+	"io"
 	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"text/template"
 	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if c, ok := commands[os.Args[1]]; ok {
+			c.run(os.Args[2:])
+			return
+		}
+	}
+
+	// No subcommand.  The flags are the same as before subcommands were added.
+
+	var s search
+	var o outputs
+
+	s.addFlags(flag.CommandLine)
+	o.addFlags(flag.CommandLine)
+	flag.Usage = legacyUsage
+
+	parseFlags(flag.CommandLine, os.Args[1:])
+
+	query, err := s.query(flag.CommandLine, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	run(query, &o)
+}
+
+// search holds the search criteria flags.
+type search struct {
+	eventid           string
+	eventidFile       string
+	start             string
+	end               string
+	minUsedPhaseCount int
+	minMagnitude      float64
+	maxMagnitude      float64
+	minDepth          float64
+	maxDepth          float64
+	bbox              string
+	latitude          float64
+	longitude         float64
+	minRadius         float64
+	maxRadius         float64
+	fdsn              string
+	orderBy           string
+	offset            int
+	limit             int
+}
+
+// addFlags adds the search criteria flags to fs.
+func (s *search) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.eventid, "eventid", "", "a valid eventid for a GeoNet event e.g., --eventid 2012p070732, or a comma separated list of eventids.  If specifying eventid then start and end are not needed.")
+	fs.StringVar(&s.eventidFile, "eventid-file", "", "search for the eventids in this file, one per line.  Use - for stdin.  Can be combined with --eventid.")
+	fs.StringVar(&s.start, "start", "", "start date time for the search in ISO8601 format to s precision e.g., 2014-02-22T04:06:25Z")
+	fs.StringVar(&s.end, "end", "", "end date time for the search in ISO8601 format to s precision e.g., 2014-02-22T05:06:25Z")
+	fs.IntVar(&s.minUsedPhaseCount, "min-used-phase-count", -999, "the minimum used phase count.  Comparison is >=")
+	fs.Float64Var(&s.minMagnitude, "min-magnitude", -999.9, "the minimum magnitude.  Comparison is >=")
+	fs.StringVar(&s.bbox, "bbox", "", "search for quakes inside the bbox - a comma separated string of upper left and lower right bounday box coordinates for e.g., 174,-41,175,-42")
+	fs.Float64Var(&s.maxMagnitude, "max-magnitude", 0, "the maximum magnitude.  Comparison is <=")
+	fs.Float64Var(&s.minDepth, "min-depth", 0, "the minimum depth in km.  Comparison is >=")
+	fs.Float64Var(&s.maxDepth, "max-depth", 0, "the maximum depth in km.  Comparison is <=")
+	fs.Float64Var(&s.latitude, "latitude", 0, "search for quakes within --max-radius of this latitude and --longitude.")
+	fs.Float64Var(&s.longitude, "longitude", 0, "search for quakes within --max-radius of --latitude and this longitude.")
+	fs.Float64Var(&s.minRadius, "min-radius", 0, "the minimum distance in degrees from --latitude and --longitude.")
+	fs.Float64Var(&s.maxRadius, "max-radius", 180, "the maximum distance in degrees from --latitude and --longitude.")
+	fs.StringVar(&s.fdsn, "fdsn", "",
+		"search with FDSN event web service query parameters e.g., --fdsn 'starttime=2014-01-01&endtime=2014-02-01&minmagnitude=4&latitude=-41.3&longitude=174.8&maxradius=1&orderby=magnitude&limit=10'")
+}
+
+// query returns the WFS query for the search criteria set in fs.  If strict is true it is an error
+// to combine eventids with the other criteria or to give no criteria.  Otherwise the criteria that
+// are not used are logged and ignored.
+func (s *search) query(fs *flag.FlagSet, strict bool) (q wfs.Query, err error) {
+	if s.fdsn != "" {
+		v, err := url.ParseQuery(s.fdsn)
+		if err != nil {
+			return q, fmt.Errorf("--fdsn: %v", err)
+		}
+		if err = s.setFDSN(fs, v); err != nil {
+			return q, fmt.Errorf("--fdsn: %v", err)
+		}
+	}
 
-	// Parse and validate command line flags.
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-	pickFormat := seiscompml07.PickFormat()
-	arrivalFormat := seiscompml07.ArrivalFormat()
-	eventFormat := wfs.EventFormat()
+	ids, err := s.eventIDs()
+	if err != nil {
+		return q, err
+	}
 
-	eventid := flag.String("eventid", "", "a valid eventid for a GeoNet event e.g., --eventid 2012p070732.  If specifying eventid then start and end are not needed.")
-	var start = flag.String("start", "", "start date time for the search in ISO8601 format to s precision e.g., 2014-02-22T04:06:25Z")
-	var end = flag.String("end", "", "end date time for the search in ISO8601 format to s precision e.g., 2014-02-22T05:06:25Z")
-	var poArrivals = flag.Bool("preferred-origin-arrivals", false,
+	switch {
+	case s.start != "" && s.end != "":
+		if len(ids) > 0 {
+			if strict {
+				return q, errors.New("--eventid and --eventid-file can't be used with --start and --end")
+			}
+			warnf("Ignoring eventids.  Searching between --start and --end.")
+		}
+
+		st, err := time.Parse(time.RFC3339, s.start)
+		if err != nil {
+			return q, err
+		}
+		e, err := time.Parse(time.RFC3339, s.end)
+		if err != nil {
+			return q, err
+		}
+		if st.After(e) {
+			return q, errors.New("start time is after end time")
+		}
+
+		q = wfs.Query{Start: st, End: e, MinUsedPhaseCount: s.minUsedPhaseCount, MinMagnitude: s.minMagnitude, Bbox: s.bbox}
+
+		if set["max-magnitude"] {
+			q.MaxMagnitude = &s.maxMagnitude
+		}
+		if set["min-depth"] {
+			q.MinDepth = &s.minDepth
+		}
+		if set["max-depth"] {
+			q.MaxDepth = &s.maxDepth
+		}
+
+		switch {
+		case set["latitude"] && set["longitude"]:
+			q.Circle = &wfs.Circle{Latitude: s.latitude, Longitude: s.longitude, MinRadius: s.minRadius, MaxRadius: s.maxRadius}
+		case set["latitude"] || set["longitude"]:
+			return q, errors.New("--latitude and --longitude must be used together")
+		case set["min-radius"] || set["max-radius"]:
+			return q, errors.New("--min-radius and --max-radius need --latitude and --longitude")
+		}
+	case len(ids) > 0:
+		var ignored []string
+		for _, n := range criteriaFlags {
+			if n == "fdsn" {
+				continue
+			}
+			if set[n] {
+				ignored = append(ignored, "--"+n)
+			}
+		}
+		if len(ignored) > 0 {
+			if strict {
+				return q, fmt.Errorf("%s can't be used with eventids", strings.Join(ignored, ", "))
+			}
+			warnf("Ignoring %s.  Searching for eventids only.", strings.Join(ignored, ", "))
+		}
+
+		q, err = eventQuery(ids)
+	case strict:
+		err = errors.New("either --eventid, --eventid-file, or --start and --end must be provided")
+	}
+
+	q.OrderBy = s.orderBy
+	q.Offset = s.offset
+	q.Limit = s.limit
+
+	return q, err
+}
+
+// eventIDs returns the eventids from --eventid and --eventid-file in order with duplicates removed.
+// Blank lines and lines starting with # in the file are skipped.
+func (s *search) eventIDs() (ids []string, err error) {
+	var l []string
+
+	if s.eventid != "" {
+		l = strings.Split(s.eventid, ",")
+	}
+
+	if s.eventidFile != "" {
+		var r io.Reader = os.Stdin
+
+		if s.eventidFile != "-" {
+			f, err := os.Open(s.eventidFile)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			l = append(l, sc.Text())
+		}
+		if err = sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+
+	for _, id := range l {
+		id = strings.TrimSpace(id)
+		if id == "" || strings.HasPrefix(id, "#") || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// eventQuery returns the WFS query for the eventids.
+func eventQuery(ids []string) (q wfs.Query, err error) {
+	pidr, _ := regexp.Compile("^[a-z0-9]+$")
+	for _, id := range ids {
+		if !pidr.MatchString(id) {
+			return q, errors.New("invalid eventid: " + id)
+		}
+	}
+
+	if len(ids) == 1 {
+		return wfs.Query{EventID: ids[0]}, nil
+	}
+
+	return wfs.Query{EventIDs: ids}, nil
+}
+
+// outputs holds the output selection, format, filter, and file flags.
+type outputs struct {
+	event               bool
+	eventF              string
+	eventOut            string
+	picks               bool
+	picksF              string
+	picksOut            string
+	poArrivals          bool
+	arrivalsF           string
+	arrivalsOut         string
+	pOrigin             bool
+	origins             bool
+	originF             string
+	originOut           string
+	magnitudes          bool
+	magnitudeF          string
+	magnitudeOut        string
+	stationMagnitudes   bool
+	stationMagnitudeF   string
+	stationMagnitudeOut string
+	amplitudes          bool
+	amplitudeF          string
+	amplitudeOut        string
+	focalMechanisms     bool
+	focalMechanismF     string
+	focalMechanismOut   string
+	header              bool
+	pickAuthor          string
+	pickEvaluationMode  string
+	excludeAgency       string
+	sortBy              string
+	unique              bool
+	outDir              string
+	parquetDir          string
+	sqliteDB            string
+	geoJSON             string
+	tmpl                string
+	tmplFile            string
+	hypoDD              string
+}
+
+// The format keys for each output.
+var (
+	pickFormat             = seiscompml07.PickFormat()
+	arrivalFormat          = seiscompml07.ArrivalFormat()
+	originFormat           = seiscompml07.OriginFormat()
+	magnitudeFormat        = seiscompml07.MagnitudeFormat()
+	stationMagnitudeFormat = seiscompml07.StationMagnitudeFormat()
+	amplitudeFormat        = seiscompml07.AmplitudeFormat()
+	focalMechanismFormat   = seiscompml07.FocalMechanismFormat()
+	eventFormat            = mergeFormat(wfs.EventFormat(), seiscompml07.EventFormat())
+)
+
+// addFlags adds all the output flags to fs.
+func (o *outputs) addFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.poArrivals, "preferred-origin-arrivals", false,
 		"output Arrival information for the PreferredOrigin.  An arrival-format must be specified.  An Arrival is a Pick associated with an Origin.")
-	var arrivalsF = flag.String("arrivals-format", "",
+	fs.StringVar(&o.arrivalsF, "arrivals-format", "",
 		"output format selector for Arrival information.  Any combination and any order of the following values, separated by ',': "+formatString(arrivalFormat))
-	var event = flag.Bool("event", false, "output event information.  An event-format must be specified.")
-	var eventF = flag.String("event-format", "",
+	fs.BoolVar(&o.pOrigin, "preferred-origin", false,
+		"output location and quality information for the PreferredOrigin.  An origin-format must be specified.")
+	fs.BoolVar(&o.origins, "origins", false, "output location and quality information for all Origins of the Event.  An origin-format must be specified.")
+	fs.StringVar(&o.originF, "origin-format", "",
+		"output format selector for Origin information.  Any combination and any order of the following values, separated by ',': "+formatString(originFormat))
+	fs.BoolVar(&o.magnitudes, "magnitudes", false, "output information for all Magnitudes of the Event.  A magnitude-format must be specified.")
+	fs.StringVar(&o.magnitudeF, "magnitude-format", "",
+		"output format selector for Magnitude information.  Any combination and any order of the following values, separated by ',': "+formatString(magnitudeFormat))
+	fs.BoolVar(&o.stationMagnitudes, "station-magnitudes", false,
+		"output the station magnitudes that contribute to each Magnitude of the Event.  A station-magnitude-format must be specified.")
+	fs.StringVar(&o.stationMagnitudeF, "station-magnitude-format", "",
+		"output format selector for station magnitude information.  Any combination and any order of the following values, separated by ',': "+formatString(stationMagnitudeFormat))
+	fs.BoolVar(&o.amplitudes, "amplitudes", false, "output Amplitude information for the Event.  An amplitude-format must be specified.")
+	fs.StringVar(&o.amplitudeF, "amplitude-format", "",
+		"output format selector for Amplitude information.  Any combination and any order of the following values, separated by ',': "+formatString(amplitudeFormat))
+	fs.BoolVar(&o.focalMechanisms, "focal-mechanisms", false,
+		"output FocalMechanism and MomentTensor information for the Event.  A focal-mechanism-format must be specified.")
+	fs.StringVar(&o.focalMechanismF, "focal-mechanism-format", "",
+		"output format selector for FocalMechanism information.  Any combination and any order of the following values, separated by ',': "+formatString(focalMechanismFormat))
+	fs.BoolVar(&o.event, "event", false, "output event information.  An event-format must be specified.")
+	fs.StringVar(&o.eventF, "event-format", "",
 		"output format selector for event information.  Any combination and any order of the following values, separated by ',': "+formatString(eventFormat))
-	var picks = flag.Bool("picks", false, "output Pick information for the Event.  A pick-format must be specified.")
-	var picksF = flag.String("picks-format", "",
+	fs.BoolVar(&o.picks, "picks", false, "output Pick information for the Event.  A pick-format must be specified.")
+	fs.StringVar(&o.picksF, "picks-format", "",
 		"output format selector for Pick information.  Any combination and any order of the following values, separated by ',': "+formatString(pickFormat))
-	var header = flag.Bool("header", false, "turns off the output of a header line.")
-	var minUsedPhaseCount = flag.Int("min-used-phase-count", -999, "the minimum used phase count.  Comparison is >=")
-	var minMagnitude = flag.Float64("min-magnitude", -999.9, "the minimum magnitude.  Comparison is >=")
-	var bbox = flag.String("bbox", "", "search for quakes inside the bbox - a comma separated string of upper left and lower right bounday box coordinates for e.g., 174,-41,175,-42")
+	fs.BoolVar(&o.header, "header", false, "turns off the output of a header line.")
+	o.addFilterFlags(fs)
+	o.addSortFlags(fs)
+	fs.StringVar(&o.eventOut, "event-out", "", "write event information to this file instead of stdout.  Implies --event.")
+	fs.StringVar(&o.picksOut, "picks-out", "", "write Pick information to this file instead of stdout.  Implies --picks.")
+	fs.StringVar(&o.arrivalsOut, "arrivals-out", "",
+		"write Arrival information to this file instead of stdout.  Implies --preferred-origin-arrivals.")
+	fs.StringVar(&o.originOut, "origin-out", "",
+		"write Origin information to this file instead of stdout.  Implies --preferred-origin unless --origins is used.")
+	fs.StringVar(&o.magnitudeOut, "magnitude-out", "", "write Magnitude information to this file instead of stdout.  Implies --magnitudes.")
+	fs.StringVar(&o.stationMagnitudeOut, "station-magnitude-out", "",
+		"write station magnitude information to this file instead of stdout.  Implies --station-magnitudes.")
+	fs.StringVar(&o.amplitudeOut, "amplitude-out", "", "write Amplitude information to this file instead of stdout.  Implies --amplitudes.")
+	fs.StringVar(&o.focalMechanismOut, "focal-mechanism-out", "",
+		"write FocalMechanism information to this file instead of stdout.  Implies --focal-mechanisms.")
+	fs.StringVar(&o.outDir, "out-dir", "",
+		"write the selected outputs to events.csv, origins.csv, magnitudes.csv, station-magnitudes.csv, amplitudes.csv, focal-mechanisms.csv, picks.csv, and arrivals.csv in this directory instead of stdout.  The --*-out options take precedence.")
+	fs.StringVar(&o.parquetDir, "parquet", "",
+		"write the selected outputs to events.parquet, origins.parquet, magnitudes.parquet, station-magnitudes.parquet, amplitudes.parquet, focal-mechanisms.parquet, picks.parquet, and arrivals.parquet in this directory instead of CSV on stdout.")
+	fs.StringVar(&o.sqliteDB, "sqlite", "",
+		"upsert events, origins, magnitudes, station magnitudes, amplitudes, focal mechanisms, picks, and arrivals into this SQLite database.  The database is created if it does not exist.")
+	fs.StringVar(&o.geoJSON, "geojson", "",
+		"write the events as GeoJSON to this file.  Each event has an epicentre point and, if available, the horizontal error ellipse for the PreferredOrigin.")
+	fs.StringVar(&o.tmpl, "template", "",
+		"format the output with this Go text/template.  The template is executed once with .Events - the typed event information.  See the README for the available fields.")
+	fs.StringVar(&o.tmplFile, "template-file", "", "as for --template but read the template from this file.")
+	fs.StringVar(&o.hypoDD, "hypodd", "",
+		"write hypoDD/GrowClust phase.dat and event.dat files for the PreferredOrigin to this directory, along with an event-ids.csv mapping table of integer IDs to eventids.  An existing event-ids.csv is reused.")
+}
 
-	flag.Parse()
+// addFilterFlags adds the Pick and agency filter flags to fs.
+func (o *outputs) addFilterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.pickAuthor, "pick-author", "",
+		"only output Picks and Arrivals created by an author matching this pattern e.g., scautopick@* for automatic picks.  * matches any characters.")
+	fs.StringVar(&o.pickEvaluationMode, "pick-evaluation-mode", "",
+		"only output Picks and Arrivals with a Pick of this evaluation mode; manual or automatic.")
+	fs.StringVar(&o.excludeAgency, "exclude-agency", "",
+		"do not output Origins, Magnitudes, station magnitudes, Amplitudes, FocalMechanisms, Picks, or Arrivals created by these agencies.  A comma separated list of agency IDs.")
+}
 
-	// Check that each output option has a format provided and that all the format parameters are legal keys.
+// addSortFlags adds the sorting and deduplication flags to fs.
+func (o *outputs) addSortFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.sortBy, "sort-by", "",
+		"sort each output by these columns, separated by ','.  Prefix a column with - to sort in descending order e.g., OriginTime,-Magnitude.  Columns that are not in the format for an output are ignored for that output.")
+	fs.BoolVar(&o.unique, "unique", false, "do not output rows that are the same as an earlier row for the selected columns.")
+}
 
-	if *event && *eventF == "" {
-		log.Fatal("--event selected but no --event-format provided.")
+// validate calls check and exits if there is an error.
+func (o *outputs) validate() {
+	if err := o.check(); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	if *event {
-		checkFormat(eventF, eventFormat)
+// check sets the outputs that are implied by the --*-out flags and checks that each output option
+// has a format provided and that all the format parameters are legal keys.
+func (o *outputs) check() error {
+	o.event = o.event || o.eventOut != ""
+	o.picks = o.picks || o.picksOut != ""
+	o.poArrivals = o.poArrivals || o.arrivalsOut != ""
+	o.pOrigin = o.pOrigin || (o.originOut != "" && !o.origins)
+	o.magnitudes = o.magnitudes || o.magnitudeOut != ""
+	o.stationMagnitudes = o.stationMagnitudes || o.stationMagnitudeOut != ""
+	o.amplitudes = o.amplitudes || o.amplitudeOut != ""
+	o.focalMechanisms = o.focalMechanisms || o.focalMechanismOut != ""
+
+	if o.event && o.eventF == "" {
+		return errors.New("--event selected but no --event-format provided.")
 	}
 
-	if *picks && *picksF == "" {
-		log.Fatal("--picks selected but no --picks-format provided.")
+	if o.event {
+		if err := checkFormat(o.eventF, eventFormat); err != nil {
+			return err
+		}
 	}
 
-	if *picks {
-		checkFormat(picksF, pickFormat)
+	if o.picks && o.picksF == "" {
+		return errors.New("--picks selected but no --picks-format provided.")
 	}
 
-	if *poArrivals && *arrivalsF == "" {
-		log.Fatal("--arrivals selected but no --arrivals-format provided.")
+	if o.picks {
+		if err := checkFormat(o.picksF, pickFormat); err != nil {
+			return err
+		}
 	}
 
-	if *poArrivals {
-		checkFormat(arrivalsF, arrivalFormat)
+	if o.poArrivals && o.arrivalsF == "" {
+		return errors.New("--arrivals selected but no --arrivals-format provided.")
 	}
 
-	var query wfs.Query
+	if o.poArrivals {
+		if err := checkFormat(o.arrivalsF, arrivalFormat); err != nil {
+			return err
+		}
+	}
 
-	if !(*start == "" || *end == "") {
-		s, err := time.Parse(time.RFC3339, *start)
-		if err != nil {
-			log.Fatal(err)
+	if o.pOrigin && o.originF == "" {
+		return errors.New("--preferred-origin selected but no --origin-format provided.")
+	}
+
+	if o.origins && o.originF == "" {
+		return errors.New("--origins selected but no --origin-format provided.")
+	}
+
+	if o.pOrigin || o.origins {
+		if err := checkFormat(o.originF, originFormat); err != nil {
+			return err
 		}
-		e, err := time.Parse(time.RFC3339, *end)
-		if err != nil {
-			log.Fatal(err)
+	}
+
+	if o.magnitudes && o.magnitudeF == "" {
+		return errors.New("--magnitudes selected but no --magnitude-format provided.")
+	}
+
+	if o.magnitudes {
+		if err := checkFormat(o.magnitudeF, magnitudeFormat); err != nil {
+			return err
 		}
-		if s.After(e) {
-			log.Fatal("start time is after end time.")
+	}
+
+	if o.stationMagnitudes && o.stationMagnitudeF == "" {
+		return errors.New("--station-magnitudes selected but no --station-magnitude-format provided.")
+	}
+
+	if o.stationMagnitudes {
+		if err := checkFormat(o.stationMagnitudeF, stationMagnitudeFormat); err != nil {
+			return err
 		}
-		query = wfs.Query{Start: s, End: e, MinUsedPhaseCount: *minUsedPhaseCount, MinMagnitude: *minMagnitude, Bbox: *bbox}
-	} else if *eventid != "" {
-		pidr, _ := regexp.Compile("^[a-z0-9]+$")
-		if !pidr.MatchString(*eventid) {
-			log.Fatal("invalid eventid.")
+	}
+
+	if o.amplitudes && o.amplitudeF == "" {
+		return errors.New("--amplitudes selected but no --amplitude-format provided.")
+	}
+
+	if o.amplitudes {
+		if err := checkFormat(o.amplitudeF, amplitudeFormat); err != nil {
+			return err
+		}
+	}
+
+	if o.focalMechanisms && o.focalMechanismF == "" {
+		return errors.New("--focal-mechanisms selected but no --focal-mechanism-format provided.")
+	}
+
+	if o.focalMechanisms {
+		if err := checkFormat(o.focalMechanismF, focalMechanismFormat); err != nil {
+			return err
+		}
+	}
+
+	var formats []map[string]string
+	for _, f := range []struct {
+		selected bool
+		format   map[string]string
+	}{
+		{o.event, eventFormat},
+		{o.picks, pickFormat},
+		{o.poArrivals, arrivalFormat},
+		{o.pOrigin || o.origins, originFormat},
+		{o.magnitudes, magnitudeFormat},
+		{o.stationMagnitudes, stationMagnitudeFormat},
+		{o.amplitudes, amplitudeFormat},
+		{o.focalMechanisms, focalMechanismFormat},
+	} {
+		if f.selected {
+			formats = append(formats, f.format)
 		}
-		query = wfs.Query{EventID: *eventid}
 	}
 
-	log.Printf("Searching for quakes")
+	if err := checkSort(o.sortBy, formats...); err != nil {
+		return err
+	}
+
+	if _, err := path.Match(o.pickAuthor, ""); err != nil {
+		return errors.New("Invalid --pick-author pattern: " + o.pickAuthor)
+	}
+
+	if o.pickEvaluationMode != "" && o.pickEvaluationMode != "manual" && o.pickEvaluationMode != "automatic" {
+		return errors.New("--pick-evaluation-mode must be manual or automatic.")
+	}
+
+	return nil
+}
+
+// run searches for quakes with query and writes the outputs selected in o.
+func run(query wfs.Query, o *outputs) {
+	o.validate()
+
+	var t *template.Template
 
-	quakes, err := query.Get()
+	if o.tmpl != "" || o.tmplFile != "" {
+		var err error
+		if t, err = parseTemplate(o.tmpl, o.tmplFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	r, err := find(query, o, templateDetails(t))
 	if err != nil {
 		log.Println("Error searching for quakes.")
 		log.Fatal(err)
 	}
 
+	o.write(r, t)
+}
+
+// write writes the outputs selected in o for the results r.  If t is not nil it is executed for the
+// quakes.
+func (o *outputs) write(r results, t *template.Template) {
+	if o.event {
+		output(o.eventF, o.arrange(o.eventF, r.quakes, eventFormat), eventTypes, o.header, o.parquetDir,
+			outPath(o.eventOut, o.outDir, "events"), "events")
+	}
+
+	if o.pOrigin || o.origins {
+		output(o.originF, r.origins, originTypes, o.header, o.parquetDir, outPath(o.originOut, o.outDir, "origins"), "origins")
+	}
+
+	if o.magnitudes {
+		output(o.magnitudeF, r.magnitudes, magnitudeTypes, o.header, o.parquetDir, outPath(o.magnitudeOut, o.outDir, "magnitudes"), "magnitudes")
+	}
+
+	if o.stationMagnitudes {
+		output(o.stationMagnitudeF, r.stationMagnitudes, stationMagnitudeTypes, o.header, o.parquetDir,
+			outPath(o.stationMagnitudeOut, o.outDir, "station-magnitudes"), "station-magnitudes")
+	}
+
+	if o.amplitudes {
+		output(o.amplitudeF, r.amplitudes, amplitudeTypes, o.header, o.parquetDir, outPath(o.amplitudeOut, o.outDir, "amplitudes"), "amplitudes")
+	}
+
+	if o.focalMechanisms {
+		output(o.focalMechanismF, r.focalMechanisms, focalMechanismTypes, o.header, o.parquetDir,
+			outPath(o.focalMechanismOut, o.outDir, "focal-mechanisms"), "focal-mechanisms")
+	}
+
+	if o.picks {
+		output(o.picksF, r.picks, pickTypes, o.header, o.parquetDir, outPath(o.picksOut, o.outDir, "picks"), "picks")
+	}
+
+	if o.poArrivals {
+		output(o.arrivalsF, r.arrivals, arrivalTypes, o.header, o.parquetDir, outPath(o.arrivalsOut, o.outDir, "arrivals"), "arrivals")
+	}
+
+	if t != nil {
+		if err := executeTemplate(os.Stdout, t, r.props, r.details); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if o.geoJSON != "" {
+		if err := writeFile(o.geoJSON, func(f *os.File) error { return writeGeoJSON(f, r.props, r.details) }); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if o.sqliteDB != "" {
+		if err := writeSQLite(o.sqliteDB, r.quakes, r.details); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if o.hypoDD != "" {
+		if err := writeHypoDD(o.hypoDD, r.quakes, r.details); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// results are the quakes and quake details found for a search.  The detail rows are filtered and
+// arranged for output.
+type results struct {
+	props             []wfs.Properties
+	quakes            []map[string]string
+	details           map[string]seiscompml07.Event
+	origins           []map[string]string
+	magnitudes        []map[string]string
+	stationMagnitudes []map[string]string
+	amplitudes        []map[string]string
+	focalMechanisms   []map[string]string
+	picks             []map[string]string
+	arrivals          []map[string]string
+}
+
+// searchQuakes searches the --backend service for quakes with query.
+func searchQuakes(query wfs.Query) ([]wfs.Properties, error) {
+	if backend == "wfs" {
+		return query.Properties()
+	}
+	return fdsnevent.Properties(query)
+}
+
+// find searches for quakes with query.  The quake details are fetched if they are needed for the
+// outputs selected in o or if details is true.
+func find(query wfs.Query, o *outputs, details bool) (r results, err error) {
+	infof("Searching for quakes")
+
+	props, err := searchQuakes(query)
+	if err != nil {
+		return r, err
+	}
+
+	return findDetails(props, o, details), nil
+}
+
+// findDetails returns the results for the quakes props.  The quake details are fetched if they are
+// needed for the outputs selected in o or if details is true.
+func findDetails(props []wfs.Properties, o *outputs, details bool) results {
+	// Event columns that are not in the WFS come from the quake details.
+	eventDetails := false
+	if o.event {
+		wf := wfs.EventFormat()
+		for _, s := range strings.Split(o.eventF, ",") {
+			if _, ok := wf[s]; !ok {
+				eventDetails = true
+			}
+		}
+	}
+
+	var agencies []string
+	if o.excludeAgency != "" {
+		agencies = strings.Split(o.excludeAgency, ",")
+	}
+
+	quakes := make([]map[string]string, len(props))
+	for i := range props {
+		quakes[i] = props[i].Map()
+	}
+
 	// Fetch SeisCompML information if it is required in the output
 
 	var qDetails map[string]seiscompml07.Event
 
-	if *picks || *poArrivals {
+	if eventDetails || o.picks || o.poArrivals || o.pOrigin || o.origins || o.magnitudes || o.stationMagnitudes || o.amplitudes || o.focalMechanisms || o.hypoDD != "" || o.sqliteDB != "" || o.geoJSON != "" || details {
 
 		qDetails = make(map[string]seiscompml07.Event)
 
-		log.Printf("Searching for quake details.  This can take some time.\n")
+		if seiscompml07.CacheDir != "" {
+			expireCache(seiscompml07.CacheDir, quakes)
+		}
+
+		infof("Searching for quake details.  This can take some time.")
 
 		i := 0
 		x := make([]string, len(quakes))
@@ -116,11 +681,24 @@ func main() {
 
 		qDetails = seiscompml07.Get(x)
 
-		log.Printf("Found quake details for %v quakes.", len(qDetails))
+		infof("Found quake details for %v quakes.", len(qDetails))
 
 		if len(quakes) > len(qDetails) {
-			log.Printf("Failed to find details for %v quakes.  These might be in The Gap.\n", len(quakes)-len(qDetails))
-			log.Println("Please see http://info.geonet.org.nz/display/appdata/The+Gap.")
+			warnf("Failed to find details for %v quakes.  These might be in The Gap.", len(quakes)-len(qDetails))
+			warnf("Please see http://info.geonet.org.nz/display/appdata/The+Gap.")
+		}
+	}
+
+	// Merge the event type, description, and comments from the quake details with the WFS information.
+	// Values from the WFS take precedence.
+
+	for _, q := range quakes {
+		if d, ok := qDetails[q["EventID"]]; ok {
+			for k, v := range d.EventMap() {
+				if q[k] == "" {
+					q[k] = v
+				}
+			}
 		}
 	}
 
@@ -129,68 +707,148 @@ func main() {
 	// These all follow the same pattern.  The user supplies a list of ',' separated fields that they want to output
 	// the values for.  This is split into a slice and then used to lookup the required values in a Map of the data.
 
-	if *event {
-		oF := strings.Split(*eventF, ",")
-		o := make([]string, len(oF))
-		if *header {
-			fmt.Println(strings.Join(oF, ","))
+	var originRows, magnitudeRows, stationMagnitudeRows, amplitudeRows, focalMechanismRows, pickRows, arrivalRows []map[string]string
+
+	for _, q := range quakes {
+		eid := q["EventID"]
+		e, ok := qDetails[eid]
+		if !ok {
+			continue
 		}
-		for _, v := range quakes {
-			for i, n := range oF {
-				o[i] = v[n]
+
+		for _, v := range e.OriginMap() {
+			if o.origins || v["IsPreferred"] == "true" {
+				v["EventID"] = eid
+				originRows = append(originRows, v)
 			}
-			fmt.Println(strings.Join(o, ","))
 		}
-	}
-
-	if *picks {
-		oF := strings.Split(*picksF, ",")
-		o := make([]string, len(oF))
-		if *header {
-			fmt.Println(strings.Join(oF, ","))
+		for _, v := range e.MagnitudeMap() {
+			v["EventID"] = eid
+			magnitudeRows = append(magnitudeRows, v)
 		}
-
-		for eid, e := range qDetails {
-			for _, v := range e.PickMap() {
-				// Add the publicid from the WFS search, rather than the logical one from in the SeisComPML.
+		for _, v := range e.StationMagnitudeMap() {
+			v["EventID"] = eid
+			stationMagnitudeRows = append(stationMagnitudeRows, v)
+		}
+		for _, v := range e.AmplitudeMap() {
+			v["EventID"] = eid
+			amplitudeRows = append(amplitudeRows, v)
+		}
+		for _, v := range e.FocalMechanismMap() {
+			v["EventID"] = eid
+			focalMechanismRows = append(focalMechanismRows, v)
+		}
+		for _, v := range e.PickMap() {
+			// Add the publicid from the WFS search, rather than the logical one from in the SeisComPML.
+			v["EventID"] = eid
+			pickRows = append(pickRows, v)
+		}
+		if o.poArrivals && e.PreferredOrigin != nil {
+			for _, v := range e.PreferredOrigin.ArrivalMap() {
 				v["EventID"] = eid
-				for i, n := range oF {
-					o[i] = v[n]
-				}
-				fmt.Println(strings.Join(o, ","))
+				arrivalRows = append(arrivalRows, v)
 			}
 		}
 	}
 
-	if *poArrivals {
-		oF := strings.Split(*arrivalsF, ",")
-		o := make([]string, len(oF))
-		if *header {
-			fmt.Println(strings.Join(oF, ","))
+	originRows = filterRows(originRows, agencies, "", "")
+	magnitudeRows = filterRows(magnitudeRows, agencies, "", "")
+	stationMagnitudeRows = filterRows(stationMagnitudeRows, agencies, "", "")
+	amplitudeRows = filterRows(amplitudeRows, agencies, "", "")
+	focalMechanismRows = filterRows(focalMechanismRows, agencies, "", "")
+	pickRows = filterRows(pickRows, agencies, o.pickAuthor, o.pickEvaluationMode)
+	arrivalRows = filterRows(arrivalRows, agencies, o.pickAuthor, o.pickEvaluationMode)
+
+	// Rows are in the order of the quakes and then the order in the quake details unless --sort-by is used.
+
+	originRows = o.arrange(o.originF, originRows, originFormat)
+	magnitudeRows = o.arrange(o.magnitudeF, magnitudeRows, magnitudeFormat)
+	stationMagnitudeRows = o.arrange(o.stationMagnitudeF, stationMagnitudeRows, stationMagnitudeFormat)
+	amplitudeRows = o.arrange(o.amplitudeF, amplitudeRows, amplitudeFormat)
+	focalMechanismRows = o.arrange(o.focalMechanismF, focalMechanismRows, focalMechanismFormat)
+	pickRows = o.arrange(o.picksF, pickRows, pickFormat)
+	arrivalRows = o.arrange(o.arrivalsF, arrivalRows, arrivalFormat)
+
+	return results{
+		props:             props,
+		quakes:            quakes,
+		details:           qDetails,
+		origins:           originRows,
+		magnitudes:        magnitudeRows,
+		stationMagnitudes: stationMagnitudeRows,
+		amplitudes:        amplitudeRows,
+		focalMechanisms:   focalMechanismRows,
+		picks:             pickRows,
+		arrivals:          arrivalRows,
+	}
+}
+
+// output writes the values for the ',' separated format f from each row.  Rows are written as CSV
+// to the file out or stdout if out is empty.  If parquetDir is set rows are written to name.parquet in
+// parquetDir with the column types in types instead.
+func output(f string, rows []map[string]string, types map[string]parquet.Type, header bool, parquetDir, out, name string) {
+	oF := strings.Split(f, ",")
+
+	var err error
+
+	switch {
+	case parquetDir != "":
+		err = writeParquet(filepath.Join(parquetDir, name+".parquet"), oF, rows, types)
+	case out != "":
+		if err = os.MkdirAll(filepath.Dir(out), 0755); err == nil {
+			err = writeFile(out, func(w *os.File) error { return writeCSV(w, oF, rows, header) })
 		}
+	default:
+		err = writeCSV(os.Stdout, oF, rows, header)
+	}
 
-		for eid, e := range qDetails {
-			for _, v := range e.PreferredOrigin.ArrivalMap() {
-				// Add the publicid from the WFS search, rather than the logical one from in the SeisComPML.
-				v["EventID"] = eid
-				for i, n := range oF {
-					o[i] = v[n]
-				}
-				fmt.Println(strings.Join(o, ","))
-			}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeCSV writes the values for the columns oF from each row to w.  Values that contain
+// commas or quotes, e.g., descriptions and comments, are quoted.
+func writeCSV(w io.Writer, oF []string, rows []map[string]string, header bool) error {
+	c := csv.NewWriter(w)
+
+	o := make([]string, len(oF))
+	if header {
+		c.Write(oF)
+	}
+	for _, v := range rows {
+		for i, n := range oF {
+			o[i] = v[n]
 		}
+		c.Write(o)
 	}
+
+	c.Flush()
+	return c.Error()
+}
+
+// outPath returns the file to write the output name to; out if it is set or name.csv in dir
+// if that is set.  An empty string means stdout.
+func outPath(out, dir, name string) string {
+	switch {
+	case out != "":
+		return out
+	case dir != "":
+		return filepath.Join(dir, name+".csv")
+	}
+	return ""
 }
 
 // checkFormat checks that all comma separated strings in f have a key in the map.
 // used to validate the user input format string.
-func checkFormat(f *string, v map[string]string) {
-	for _, s := range strings.Split(*f, ",") {
+func checkFormat(f string, v map[string]string) error {
+	for _, s := range strings.Split(f, ",") {
 		if _, present := v[s]; !present {
-			log.Fatal("Invalid format key: " + s)
+			return errors.New("Invalid format key: " + s)
 		}
 	}
 
+	return nil
 }
 
 // formatString returns a format string for docmentation.  This gives allowable entries in the user provided
@@ -205,3 +863,37 @@ func formatString(v map[string]string) (s string) {
 	sort.Sort(sort.StringSlice(st))
 	return strings.Join(st, ",")
 }
+
+// filterRows returns the rows that were not created by one of the agencies and, if they are not empty,
+// were created by an author matching the pattern author and have the evaluation mode mode.
+func filterRows(rows []map[string]string, agencies []string, author, mode string) (f []map[string]string) {
+rows:
+	for _, v := range rows {
+		for _, a := range agencies {
+			if v["AgencyID"] == a {
+				continue rows
+			}
+		}
+		if author != "" {
+			if ok, _ := path.Match(author, v["Author"]); !ok {
+				continue
+			}
+		}
+		if mode != "" && v["EvaluationMode"] != mode {
+			continue
+		}
+		f = append(f, v)
+	}
+	return f
+}
+
+// mergeFormat returns a format with the keys from all the formats f.  Earlier formats take precedence.
+func mergeFormat(f ...map[string]string) (m map[string]string) {
+	m = make(map[string]string)
+	for i := len(f) - 1; i >= 0; i-- {
+		for k, v := range f[i] {
+			m[k] = v
+		}
+	}
+	return m
+}
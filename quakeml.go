@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io"
+	"time"
+)
+
+// smi is the prefix for QuakeML resource identifiers.
+const smi = "smi:nz.org.geonet/"
+
+// The QuakeML 1.2 BED types for writing the preferred origin and magnitude of each quake.
+type qmlQuakeML struct {
+	XMLName         xml.Name           `xml:"q:quakeml"`
+	Q               string             `xml:"xmlns:q,attr"`
+	BED             string             `xml:"xmlns,attr"`
+	EventParameters qmlEventParameters `xml:"eventParameters"`
+}
+
+type qmlEventParameters struct {
+	PublicID string     `xml:"publicID,attr"`
+	Events   []qmlEvent `xml:"event"`
+}
+
+type qmlEvent struct {
+	PublicID             string           `xml:"publicID,attr"`
+	PreferredOriginID    string           `xml:"preferredOriginID,omitempty"`
+	PreferredMagnitudeID string           `xml:"preferredMagnitudeID,omitempty"`
+	Type                 string           `xml:"type,omitempty"`
+	TypeCertainty        string           `xml:"typeCertainty,omitempty"`
+	Descriptions         []qmlDescription `xml:"description"`
+	Origin               qmlOrigin        `xml:"origin"`
+	Magnitude            *qmlMagnitude    `xml:"magnitude"`
+}
+
+type qmlDescription struct {
+	Text string `xml:"text"`
+	Type string `xml:"type,omitempty"`
+}
+
+type qmlOrigin struct {
+	PublicID         string           `xml:"publicID,attr"`
+	Time             qmlTime          `xml:"time"`
+	Latitude         qmlValue         `xml:"latitude"`
+	Longitude        qmlValue         `xml:"longitude"`
+	Depth            qmlValue         `xml:"depth"`
+	DepthType        string           `xml:"depthType,omitempty"`
+	MethodID         string           `xml:"methodID,omitempty"`
+	EarthModelID     string           `xml:"earthModelID,omitempty"`
+	Quality          qmlQuality       `xml:"quality"`
+	EvaluationMode   string           `xml:"evaluationMode,omitempty"`
+	EvaluationStatus string           `xml:"evaluationStatus,omitempty"`
+	CreationInfo     *qmlCreationInfo `xml:"creationInfo"`
+}
+
+type qmlMagnitude struct {
+	PublicID     string           `xml:"publicID,attr"`
+	Mag          qmlValue         `xml:"mag"`
+	Type         string           `xml:"type,omitempty"`
+	OriginID     string           `xml:"originID,omitempty"`
+	StationCount int              `xml:"stationCount"`
+	CreationInfo *qmlCreationInfo `xml:"creationInfo"`
+}
+
+type qmlTime struct {
+	Value string `xml:"value"`
+}
+
+type qmlValue struct {
+	Value       float64 `xml:"value"`
+	Uncertainty float64 `xml:"uncertainty,omitempty"`
+}
+
+type qmlQuality struct {
+	UsedPhaseCount   int     `xml:"usedPhaseCount"`
+	UsedStationCount int     `xml:"usedStationCount"`
+	StandardError    float64 `xml:"standardError"`
+	AzimuthalGap     float64 `xml:"azimuthalGap"`
+	MinimumDistance  float64 `xml:"minimumDistance"`
+}
+
+type qmlCreationInfo struct {
+	AgencyID     string `xml:"agencyID,omitempty"`
+	Author       string `xml:"author,omitempty"`
+	CreationTime string `xml:"creationTime,omitempty"`
+}
+
+// writeQuakeML writes the quakes in res to w as QuakeML 1.2.  Each event has its preferred origin and
+// magnitude.  Depths are in m as for QuakeML.
+func writeQuakeML(w io.Writer, res results) error {
+	q := qmlQuakeML{
+		Q:   "http://quakeml.org/xmlns/quakeml/1.2",
+		BED: "http://quakeml.org/xmlns/bed/1.2",
+		EventParameters: qmlEventParameters{
+			PublicID: smi + "eventparameters/events",
+			Events:   make([]qmlEvent, len(res.props)),
+		},
+	}
+
+	for i, p := range res.props {
+		q.EventParameters.Events[i] = qmlEventFor(p, res.details[p.PublicID])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+
+	return e.Encode(q)
+}
+
+// qmlEventFor returns the QuakeML event for the WFS properties p and the quake details d.  The origin
+// and the magnitude are each from the quake details if they are there and otherwise from the WFS.
+func qmlEventFor(p wfs.Properties, d seiscompml07.Event) (e qmlEvent) {
+	e = qmlEvent{
+		PublicID:      smi + p.PublicID,
+		Type:          p.EventType,
+		TypeCertainty: d.TypeCertainty,
+	}
+
+	if e.Type == "" {
+		e.Type = d.Type
+	}
+
+	for _, v := range d.Descriptions {
+		e.Descriptions = append(e.Descriptions, qmlDescription{Text: v.Text, Type: v.Type})
+	}
+
+	if o := d.PreferredOrigin; o != nil {
+		e.Origin = qmlOrigin{
+			PublicID: smi + o.PublicID,
+			Time:     qmlTime{Value: o.Time.Value.Format(time.RFC3339Nano)},
+			// The SeisCompML latitude and longitude uncertainties are in km rather than degrees so they are not used.
+			Latitude:         qmlValue{Value: o.Latitude.Value},
+			Longitude:        qmlValue{Value: o.Longitude.Value},
+			Depth:            qmlValue{Value: o.Depth.Value * 1000, Uncertainty: o.Depth.Uncertainty * 1000},
+			DepthType:        o.DepthType,
+			MethodID:         smiOrEmpty(o.MethodID),
+			EarthModelID:     smiOrEmpty(o.EarthModelID),
+			EvaluationMode:   o.EvaluationMode,
+			EvaluationStatus: o.EvaluationStatus,
+			Quality: qmlQuality{
+				UsedPhaseCount:   o.Quality.UsedPhaseCount,
+				UsedStationCount: o.Quality.UsedStationCount,
+				StandardError:    o.Quality.StandardError,
+				AzimuthalGap:     o.Quality.AzimuthalGap,
+				MinimumDistance:  o.Quality.MinimumDistance,
+			},
+			CreationInfo: qmlCreationInfoFor(o.CreationInfo),
+		}
+	} else {
+		e.Origin = qmlOrigin{
+			PublicID:         smi + p.PublicID + "/origin",
+			Time:             qmlTime{Value: p.OriginTime},
+			Latitude:         qmlValue{Value: p.Latitude},
+			Longitude:        qmlValue{Value: p.Longitude},
+			Depth:            qmlValue{Value: p.Depth * 1000},
+			DepthType:        p.DepthType,
+			MethodID:         smiOrEmpty(p.EvaluationMethod),
+			EarthModelID:     smiOrEmpty(p.EarthModel),
+			EvaluationMode:   p.EvaluationMode,
+			EvaluationStatus: p.EvaluationStatus,
+			Quality: qmlQuality{
+				UsedPhaseCount:   p.UsedPhaseCount,
+				UsedStationCount: p.UsedStationCount,
+				StandardError:    p.OriginError,
+				AzimuthalGap:     p.AzimuthalGap,
+				MinimumDistance:  p.MinimumDistance,
+			},
+		}
+	}
+
+	e.PreferredOriginID = e.Origin.PublicID
+
+	switch m := d.PreferredMagnitude; {
+	case m != nil:
+		e.Magnitude = &qmlMagnitude{
+			PublicID:     smi + m.PublicID,
+			Mag:          qmlValue{Value: m.Mag.Value, Uncertainty: m.Mag.Uncertainty},
+			Type:         m.Type,
+			OriginID:     smiOrEmpty(m.OriginID),
+			StationCount: m.StationCount,
+			CreationInfo: qmlCreationInfoFor(m.CreationInfo),
+		}
+	case p.MagnitudeType != "":
+		e.Magnitude = &qmlMagnitude{
+			PublicID:     smi + p.PublicID + "/magnitude",
+			Mag:          qmlValue{Value: p.Magnitude, Uncertainty: p.MagnitudeUncertainty},
+			Type:         p.MagnitudeType,
+			OriginID:     e.Origin.PublicID,
+			StationCount: p.MagnitudeStationCount,
+		}
+	default:
+		return e
+	}
+
+	e.PreferredMagnitudeID = e.Magnitude.PublicID
+
+	return e
+}
+
+// qmlCreationInfoFor returns the QuakeML creation information for c.  It is nil if c is empty.
+func qmlCreationInfoFor(c seiscompml07.CreationInfo) *qmlCreationInfo {
+	if c.AgencyID == "" && c.Author == "" && c.CreationTime.IsZero() {
+		return nil
+	}
+
+	q := &qmlCreationInfo{AgencyID: c.AgencyID, Author: c.Author}
+	if !c.CreationTime.IsZero() {
+		q.CreationTime = c.CreationTime.Format(time.RFC3339Nano)
+	}
+
+	return q
+}
+
+// smiOrEmpty returns the resource identifier for id or an empty string if id is empty.
+func smiOrEmpty(id string) string {
+	if id == "" {
+		return ""
+	}
+	return smi + id
+}
@@ -4,14 +4,22 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"github.com/GeoNet/qsearch/progress"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
-const quakeMLUrl = "http://quakeml.geonet.org.nz/quakeml/1.2/"
+// URL is where QuakeML documents are fetched from.
+var URL = "http://quakeml.geonet.org.nz/quakeml/1.2/"
+
+// CacheDir is a directory to cache QuakeML documents in.  The cache is not used if it is empty.
+// Documents are cached as publicid.xml and are not refetched while they are in the cache.
+var CacheDir string
 
 // Quakeml the top level container for unmarshalling QuakeML
 //
@@ -29,44 +37,162 @@ type EventParameters struct {
 
 // Event for unmarshalling QuakeML
 type Event struct {
-	PreferredOriginID    string      `xml:"preferredOriginID"`
-	PreferredMagnitudeID string      `xml:"preferredMagnitudeID"`
-	O                    []Origin    `xml:"origin"`
-	M                    []Magnitude `xml:"magnitude"`
-	P                    []Pick      `xml:"pick"`
-	Origins              map[string]*Origin
-	Picks                map[string]*Pick
-	Magnitudes           map[string]*Magnitude
-	PreferredOrigin      *Origin
-	PreferredMagnitude   *Magnitude
+	PreferredOriginID         string             `xml:"preferredOriginID"`
+	PreferredMagnitudeID      string             `xml:"preferredMagnitudeID"`
+	PreferredFocalMechanismID string             `xml:"preferredFocalMechanismID"`
+	Type                      string             `xml:"type"`
+	TypeCertainty             string             `xml:"typeCertainty"`
+	Descriptions              []EventDescription `xml:"description"`
+	Comments                  []Comment          `xml:"comment"`
+	O                         []Origin           `xml:"origin"`
+	M                         []Magnitude        `xml:"magnitude"`
+	P                         []Pick             `xml:"pick"`
+	SM                        []StationMagnitude `xml:"stationMagnitude"`
+	A                         []Amplitude        `xml:"amplitude"`
+	FM                        []FocalMechanism   `xml:"focalMechanism"`
+	CreationInfo              CreationInfo       `xml:"creationInfo"`
+	Origins                   map[string]*Origin
+	Picks                     map[string]*Pick
+	Magnitudes                map[string]*Magnitude
+	StationMagnitudes         map[string]*StationMagnitude
+	Amplitudes                map[string]*Amplitude
+	FocalMechanisms           map[string]*FocalMechanism
+	PreferredOrigin           *Origin
+	PreferredMagnitude        *Magnitude
+	PreferredFocalMechanism   *FocalMechanism
 }
 
 // Origin for unmarshalling QuakeML
 type Origin struct {
-	PublicID string    `xml:"publicID,attr"`
-	Time     TimeValue `xml:"time"`
-	Arrivals []Arrival `xml:"arrival"`
+	PublicID         string            `xml:"publicID,attr"`
+	Time             TimeValue         `xml:"time"`
+	Latitude         Value             `xml:"latitude"`
+	Longitude        Value             `xml:"longitude"`
+	Depth            Value             `xml:"depth"`
+	MethodID         string            `xml:"methodID"`
+	EarthModelID     string            `xml:"earthModelID"`
+	Quality          Quality           `xml:"quality"`
+	Uncertainty      OriginUncertainty `xml:"originUncertainty"`
+	EvaluationMode   string            `xml:"evaluationMode"`
+	EvaluationStatus string            `xml:"evaluationStatus"`
+	Arrivals         []Arrival         `xml:"arrival"`
+	CreationInfo     CreationInfo      `xml:"creationInfo"`
+}
+
+// Quality for unmarshalling QuakeML
+type Quality struct {
+	AssociatedPhaseCount   int     `xml:"associatedPhaseCount"`
+	UsedPhaseCount         int     `xml:"usedPhaseCount"`
+	AssociatedStationCount int     `xml:"associatedStationCount"`
+	UsedStationCount       int     `xml:"usedStationCount"`
+	StandardError          float64 `xml:"standardError"`
+	AzimuthalGap           float64 `xml:"azimuthalGap"`
+	SecondaryAzimuthalGap  float64 `xml:"secondaryAzimuthalGap"`
+	GroundTruthLevel       string  `xml:"groundTruthLevel"`
+	MinimumDistance        float64 `xml:"minimumDistance"`
+	MedianDistance         float64 `xml:"medianDistance"`
+	MaximumDistance        float64 `xml:"maximumDistance"`
+}
+
+// OriginUncertainty for unmarshalling QuakeML
+type OriginUncertainty struct {
+	HorizontalUncertainty           float64             `xml:"horizontalUncertainty"`
+	MinHorizontalUncertainty        float64             `xml:"minHorizontalUncertainty"`
+	MaxHorizontalUncertainty        float64             `xml:"maxHorizontalUncertainty"`
+	AzimuthMaxHorizontalUncertainty float64             `xml:"azimuthMaxHorizontalUncertainty"`
+	ConfidenceEllipsoid             ConfidenceEllipsoid `xml:"confidenceEllipsoid"`
+	PreferredDescription            string              `xml:"preferredDescription"`
+	ConfidenceLevel                 float64             `xml:"confidenceLevel"`
+}
+
+// ConfidenceEllipsoid for unmarshalling QuakeML
+type ConfidenceEllipsoid struct {
+	SemiMajorAxisLength        float64 `xml:"semiMajorAxisLength"`
+	SemiMinorAxisLength        float64 `xml:"semiMinorAxisLength"`
+	SemiIntermediateAxisLength float64 `xml:"semiIntermediateAxisLength"`
+	MajorAxisPlunge            float64 `xml:"majorAxisPlunge"`
+	MajorAxisAzimuth           float64 `xml:"majorAxisAzimuth"`
+	MajorAxisRotation          float64 `xml:"majorAxisRotation"`
 }
 
 // Arrival for unmarshalling QuakeML
 type Arrival struct {
-	PickID       string  `xml:"pickID"`
-	Phase        string  `xml:"phase"`
-	Azimuth      float64 `xml:"azimuth"`
-	Distance     float64 `xml:"distance"`
-	TimeResidual float64 `xml:"timeResidual"`
-	TimeWeight   float64 `xml:"timeWeight"`
-	Pick         *Pick
+	PickID                     string       `xml:"pickID"`
+	Phase                      string       `xml:"phase"`
+	TimeCorrection             float64      `xml:"timeCorrection"`
+	Azimuth                    float64      `xml:"azimuth"`
+	Distance                   float64      `xml:"distance"`
+	TakeoffAngle               Value        `xml:"takeoffAngle"`
+	TimeResidual               float64      `xml:"timeResidual"`
+	HorizontalSlownessResidual float64      `xml:"horizontalSlownessResidual"`
+	BackazimuthResidual        float64      `xml:"backazimuthResidual"`
+	TimeWeight                 float64      `xml:"timeWeight"`
+	HorizontalSlownessWeight   float64      `xml:"horizontalSlownessWeight"`
+	BackazimuthWeight          float64      `xml:"backazimuthWeight"`
+	EarthModelID               string       `xml:"earthModelID"`
+	CreationInfo               CreationInfo `xml:"creationInfo"`
+	Pick                       *Pick
 }
 
 // Pick for unmarshalling QuakeML
 type Pick struct {
-	PublicID         string     `xml:"publicID,attr"`
-	Time             TimeValue  `xml:"time"`
-	WaveformID       WaveformID `xml:"waveformID"`
-	PhaseHint        string     `xml:"phaseHint"`
-	EvaluationMode   string     `xml:"evaluationMode"`
-	EvaluationStatus string     `xml:"evaluationStatus"`
+	PublicID           string       `xml:"publicID,attr"`
+	Time               TimeValue    `xml:"time"`
+	WaveformID         WaveformID   `xml:"waveformID"`
+	PhaseHint          string       `xml:"phaseHint"`
+	MethodID           string       `xml:"methodID"`
+	Polarity           string       `xml:"polarity"`
+	Onset              string       `xml:"onset"`
+	Backazimuth        Value        `xml:"backazimuth"`
+	HorizontalSlowness Value        `xml:"horizontalSlowness"`
+	SlownessMethodID   string       `xml:"slownessMethodID"`
+	EvaluationMode     string       `xml:"evaluationMode"`
+	EvaluationStatus   string       `xml:"evaluationStatus"`
+	CreationInfo       CreationInfo `xml:"creationInfo"`
+}
+
+// CreationInfo for unmarshalling QuakeML
+type CreationInfo struct {
+	AgencyID         string    `xml:"agencyID"`
+	Author           string    `xml:"author"`
+	CreationTime     time.Time `xml:"creationTime"`
+	ModificationTime time.Time `xml:"modificationTime"`
+	Version          string    `xml:"version"`
+}
+
+// creationInfoFormat adds the CreationInfo keys to the format m.
+func creationInfoFormat(m map[string]string) {
+	m["AgencyID"] = "e.g., WEL(GNS_Primary)"
+	m["Author"] = "e.g., scautopick@seiscomp3vm_1"
+	m["CreationTime"] = "e.g., 2013-12-02T03:38:26.432741Z"
+	m["ModificationTime"] = "e.g., 2013-12-02T03:38:26.432741Z"
+}
+
+// creationInfoMap adds the values from c to the map m.  Times that are not set are empty.
+func creationInfoMap(m map[string]string, c CreationInfo) {
+	m["AgencyID"] = c.AgencyID
+	m["Author"] = c.Author
+	m["CreationTime"] = ""
+	if !c.CreationTime.IsZero() {
+		m["CreationTime"] = c.CreationTime.Format(time.RFC3339Nano)
+	}
+	m["ModificationTime"] = ""
+	if !c.ModificationTime.IsZero() {
+		m["ModificationTime"] = c.ModificationTime.Format(time.RFC3339Nano)
+	}
+}
+
+// EventDescription for unmarshalling QuakeML
+type EventDescription struct {
+	Text string `xml:"text"`
+	Type string `xml:"type"`
+}
+
+// Comment for unmarshalling QuakeML
+type Comment struct {
+	ID           string       `xml:"id,attr"`
+	Text         string       `xml:"text"`
+	CreationInfo CreationInfo `xml:"creationInfo"`
 }
 
 // WaveformID for unmarshalling QuakeML
@@ -79,14 +205,18 @@ type WaveformID struct {
 
 // Value for unmarshalling QuakeML
 type Value struct {
-	Value       float64 `xml:"value"`
-	Uncertainty float64 `xml:"uncertainty"`
+	Value            float64 `xml:"value"`
+	Uncertainty      float64 `xml:"uncertainty"`
+	LowerUncertainty float64 `xml:"lowerUncertainty"`
+	UpperUncertainty float64 `xml:"upperUncertainty"`
 }
 
 // TimeValue for unmarshalling QuakeML
 type TimeValue struct {
-	Value       time.Time `xml:"value"`
-	Uncertainty float64   `xml:"uncertainty"`
+	Value            time.Time `xml:"value"`
+	Uncertainty      float64   `xml:"uncertainty"`
+	LowerUncertainty float64   `xml:"lowerUncertainty"`
+	UpperUncertainty float64   `xml:"upperUncertainty"`
 }
 
 // Mag for unmarshalling QuakeML
@@ -97,11 +227,163 @@ type Mag struct {
 
 // Magnitude for unmarshalling QuakeML
 type Magnitude struct {
-	PublicID     string `xml:"publicID,attr"`
-	Mag          Mag    `xml:"mag"`
-	Type         string `xml:"type"`
-	MethodID     string `xml:"methodID"`
-	StationCount int    `xml:"stationCount"`
+	PublicID      string                         `xml:"publicID,attr"`
+	Mag           Mag                            `xml:"mag"`
+	Type          string                         `xml:"type"`
+	OriginID      string                         `xml:"originID"`
+	MethodID      string                         `xml:"methodID"`
+	StationCount  int                            `xml:"stationCount"`
+	Contributions []StationMagnitudeContribution `xml:"stationMagnitudeContribution"`
+	CreationInfo  CreationInfo                   `xml:"creationInfo"`
+}
+
+// StationMagnitude for unmarshalling QuakeML
+type StationMagnitude struct {
+	PublicID     string       `xml:"publicID,attr"`
+	Mag          Mag          `xml:"mag"`
+	Type         string       `xml:"type"`
+	OriginID     string       `xml:"originID"`
+	AmplitudeID  string       `xml:"amplitudeID"`
+	MethodID     string       `xml:"methodID"`
+	WaveformID   WaveformID   `xml:"waveformID"`
+	CreationInfo CreationInfo `xml:"creationInfo"`
+	Amplitude    *Amplitude
+}
+
+// Amplitude for unmarshalling QuakeML
+type Amplitude struct {
+	PublicID         string       `xml:"publicID,attr"`
+	Type             string       `xml:"type"`
+	GenericAmplitude Value        `xml:"genericAmplitude"`
+	Unit             string       `xml:"unit"`
+	Period           Value        `xml:"period"`
+	SNR              float64      `xml:"snr"`
+	TimeWindow       TimeWindow   `xml:"timeWindow"`
+	PickID           string       `xml:"pickID"`
+	WaveformID       WaveformID   `xml:"waveformID"`
+	MethodID         string       `xml:"methodID"`
+	MagnitudeHint    string       `xml:"magnitudeHint"`
+	CreationInfo     CreationInfo `xml:"creationInfo"`
+	Pick             *Pick
+}
+
+// FocalMechanism for unmarshalling QuakeML
+type FocalMechanism struct {
+	PublicID             string         `xml:"publicID,attr"`
+	TriggeringOriginID   string         `xml:"triggeringOriginID"`
+	NodalPlanes          NodalPlanes    `xml:"nodalPlanes"`
+	PrincipalAxes        PrincipalAxes  `xml:"principalAxes"`
+	AzimuthalGap         float64        `xml:"azimuthalGap"`
+	StationPolarityCount int            `xml:"stationPolarityCount"`
+	Misfit               float64        `xml:"misfit"`
+	MethodID             string         `xml:"methodID"`
+	EvaluationMode       string         `xml:"evaluationMode"`
+	EvaluationStatus     string         `xml:"evaluationStatus"`
+	MomentTensors        []MomentTensor `xml:"momentTensor"`
+	CreationInfo         CreationInfo   `xml:"creationInfo"`
+}
+
+// NodalPlanes for unmarshalling QuakeML
+type NodalPlanes struct {
+	NodalPlane1    NodalPlane `xml:"nodalPlane1"`
+	NodalPlane2    NodalPlane `xml:"nodalPlane2"`
+	PreferredPlane int        `xml:"preferredPlane,attr"`
+}
+
+// NodalPlane for unmarshalling QuakeML
+type NodalPlane struct {
+	Strike Value `xml:"strike"`
+	Dip    Value `xml:"dip"`
+	Rake   Value `xml:"rake"`
+}
+
+// PrincipalAxes for unmarshalling QuakeML
+type PrincipalAxes struct {
+	TAxis Axis `xml:"tAxis"`
+	PAxis Axis `xml:"pAxis"`
+	NAxis Axis `xml:"nAxis"`
+}
+
+// Axis for unmarshalling QuakeML
+type Axis struct {
+	Azimuth Value `xml:"azimuth"`
+	Plunge  Value `xml:"plunge"`
+	Length  Value `xml:"length"`
+}
+
+// MomentTensor for unmarshalling QuakeML
+type MomentTensor struct {
+	PublicID          string       `xml:"publicID,attr"`
+	DerivedOriginID   string       `xml:"derivedOriginID"`
+	MomentMagnitudeID string       `xml:"momentMagnitudeID"`
+	ScalarMoment      Value        `xml:"scalarMoment"`
+	Tensor            Tensor       `xml:"tensor"`
+	VarianceReduction float64      `xml:"varianceReduction"`
+	DoubleCouple      float64      `xml:"doubleCouple"`
+	CLVD              float64      `xml:"clvd"`
+	MethodID          string       `xml:"methodID"`
+	CreationInfo      CreationInfo `xml:"creationInfo"`
+	MomentMagnitude   *Magnitude
+}
+
+// Tensor for unmarshalling QuakeML
+type Tensor struct {
+	Mrr Value `xml:"Mrr"`
+	Mtt Value `xml:"Mtt"`
+	Mpp Value `xml:"Mpp"`
+	Mrt Value `xml:"Mrt"`
+	Mrp Value `xml:"Mrp"`
+	Mtp Value `xml:"Mtp"`
+}
+
+// TimeWindow for unmarshalling QuakeML
+type TimeWindow struct {
+	Reference time.Time `xml:"reference"`
+	Begin     float64   `xml:"begin"`
+	End       float64   `xml:"end"`
+}
+
+// StationMagnitudeContribution for unmarshalling QuakeML
+type StationMagnitudeContribution struct {
+	StationMagnitudeID string  `xml:"stationMagnitudeID"`
+	Residual           float64 `xml:"residual"`
+	Weight             float64 `xml:"weight"`
+	StationMagnitude   *StationMagnitude
+}
+
+// EventFormat describes the values that are in the map returned by EventMap.
+// This can be used for query validation and documentation.
+func EventFormat() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventType"] = "e.g., earthquake"
+	m["EventTypeCertainty"] = "known or suspected"
+	m["Description"] = "the region name e.g., 20 km north of Wellington"
+	m["Comment"] = "the event comments separated by '; '"
+	return
+}
+
+// EventMap remaps the Event type, description, and comments in the QuakeML to allow for user selectable output.
+// The Description is the region name if there is one, otherwise the first description.
+func (e *Event) EventMap() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventType"] = e.Type
+	m["EventTypeCertainty"] = e.TypeCertainty
+	m["Description"] = ""
+	if len(e.Descriptions) > 0 {
+		m["Description"] = e.Descriptions[0].Text
+	}
+	for _, d := range e.Descriptions {
+		if d.Type == "region name" {
+			m["Description"] = d.Text
+			break
+		}
+	}
+	c := make([]string, len(e.Comments))
+	for i, v := range e.Comments {
+		c[i] = v.Text
+	}
+	m["Comment"] = strings.Join(c, "; ")
+	return
 }
 
 // PickFormat describes the values that are in the map returned by PickMap.
@@ -115,15 +397,31 @@ func PickFormat() (m map[string]string) {
 	m["LocationCode"] = "e.g., 10"
 	m["PhaseHint"] = "e.g., P"
 	m["PhaseTime"] = "e.g., TODO"
+	m["PickID"] = "the publicID of the Pick."
+	m["TimeUncertainty"] = "symmetric uncertainty of the PhaseTime (s)"
+	m["TimeLowerUncertainty"] = "lower uncertainty of the PhaseTime (s)"
+	m["TimeUpperUncertainty"] = "upper uncertainty of the PhaseTime (s)"
+	m["MethodID"] = "e.g., AIC"
+	m["Polarity"] = "e.g., positive, negative, or undecidable"
+	m["Onset"] = "e.g., impulsive, emergent, or questionable"
+	m["Backazimuth"] = "backazimuth (deg)"
+	m["BackazimuthUncertainty"] = "backazimuth uncertainty (deg)"
+	m["HorizontalSlowness"] = "horizontal slowness (s/deg)"
+	m["HorizontalSlownessUncertainty"] = "horizontal slowness uncertainty (s/deg)"
+	m["SlownessMethodID"] = "method used to measure the slowness and backazimuth."
+	m["EvaluationMode"] = "e.g., manual or automatic"
+	m["EvaluationStatus"] = "e.g., confirmed"
+	creationInfoFormat(m)
 	return m
 }
 
-// PickMap remaps the Pick information in the QuakeML to allow for user selectable output.
+// PickMap remaps the Pick information in the QuakeML to allow for user selectable output.  Picks are in
+// the order they are in the document.
 func (e *Event) PickMap() (m []map[string]string) {
-	m = make([]map[string]string, len(e.Picks))
+	m = make([]map[string]string, len(e.P))
 
-	i := 0
-	for _, p := range e.Picks {
+	for i := range e.P {
+		p := &e.P[i]
 		pm := make(map[string]string)
 		pm["NetworkCode"] = p.WaveformID.NetworkCode
 		pm["StationCode"] = p.WaveformID.StationCode
@@ -131,8 +429,22 @@ func (e *Event) PickMap() (m []map[string]string) {
 		pm["LocationCode"] = p.WaveformID.LocationCode
 		pm["PhaseHint"] = p.PhaseHint
 		pm["PhaseTime"] = p.Time.Value.Format(time.RFC3339Nano)
+		pm["PickID"] = p.PublicID
+		pm["TimeUncertainty"] = fmt.Sprintf("%f", p.Time.Uncertainty)
+		pm["TimeLowerUncertainty"] = fmt.Sprintf("%f", p.Time.LowerUncertainty)
+		pm["TimeUpperUncertainty"] = fmt.Sprintf("%f", p.Time.UpperUncertainty)
+		pm["MethodID"] = p.MethodID
+		pm["Polarity"] = p.Polarity
+		pm["Onset"] = p.Onset
+		pm["Backazimuth"] = fmt.Sprintf("%f", p.Backazimuth.Value)
+		pm["BackazimuthUncertainty"] = fmt.Sprintf("%f", p.Backazimuth.Uncertainty)
+		pm["HorizontalSlowness"] = fmt.Sprintf("%f", p.HorizontalSlowness.Value)
+		pm["HorizontalSlownessUncertainty"] = fmt.Sprintf("%f", p.HorizontalSlowness.Uncertainty)
+		pm["SlownessMethodID"] = p.SlownessMethodID
+		pm["EvaluationMode"] = p.EvaluationMode
+		pm["EvaluationStatus"] = p.EvaluationStatus
+		creationInfoMap(pm, p.CreationInfo)
 		m[i] = pm
-		i++
 	}
 
 	return m
@@ -148,19 +460,38 @@ func ArrivalFormat() (m map[string]string) {
 	m["ChannelCode"] = "e.g., HHZ"
 	m["LocationCode"] = "e.g., 10"
 	m["Phase"] = "e.g., P"
-	m["PhaseTime"] = "e.g., TODO"
+	m["PhaseTime"] = "e.g., 2012-01-27T04:06:29.798Z.  The time of the Pick."
 	m["PhaseOriginOffset"] = "e.g., PhaseTime - OriginTime (s)"
-	m["TimeResidual"] = "e.g., TODO"
-	m["TimeWeight"] = "e.g., TODO"
+	m["TimeCorrection"] = "the travel time correction (s)"
+	m["TakeoffAngle"] = "the ray takeoff angle at the source (deg)"
+	m["TimeResidual"] = "the arrival time residual, observed - calculated (s)"
+	m["HorizontalSlownessResidual"] = "the horizontal slowness residual (s/deg)"
+	m["BackazimuthResidual"] = "the backazimuth residual (deg)"
+	m["TimeWeight"] = "the weight of the arrival time in the location from 0, not used, to 1."
+	m["HorizontalSlownessWeight"] = "the weight of the horizontal slowness in the location"
+	m["BackazimuthWeight"] = "the weight of the backazimuth in the location"
+	m["EarthModelID"] = "e.g., iasp91"
+	m["Azimuth"] = "event station azimuth"
+	m["Distance"] = "event station distance"
+	m["EvaluationMode"] = "e.g., manual.  The evaluation mode of the Pick."
+	m["EvaluationStatus"] = "e.g., confirmed.  The evaluation status of the Pick."
+	creationInfoFormat(m)
+	for _, k := range []string{"AgencyID", "Author", "CreationTime", "ModificationTime"} {
+		m[k] += ".  From the Arrival or, if it has no creation information, the Pick."
+	}
 	return m
 }
 
 // ArrivalMap remaps the Arrival information in the QuakeML to allow for user selectable output.
 func (o *Origin) ArrivalMap() (m []map[string]string) {
-	m = make([]map[string]string, len(o.Arrivals))
+	m = make([]map[string]string, 0, len(o.Arrivals))
 
-	i := 0
 	for _, a := range o.Arrivals {
+		// Skip arrivals for picks that are not in the document.
+		if a.Pick == nil {
+			continue
+		}
+
 		am := make(map[string]string)
 		am["NetworkCode"] = a.Pick.WaveformID.NetworkCode
 		am["StationCode"] = a.Pick.WaveformID.StationCode
@@ -169,10 +500,397 @@ func (o *Origin) ArrivalMap() (m []map[string]string) {
 		am["Phase"] = a.Phase
 		am["PhaseTime"] = a.Pick.Time.Value.Format(time.RFC3339Nano)
 		am["PhaseOriginOffset"] = fmt.Sprintf("%f", a.Pick.Time.Value.Sub(o.Time.Value).Seconds())
+		am["TimeCorrection"] = fmt.Sprintf("%f", a.TimeCorrection)
+		am["TakeoffAngle"] = fmt.Sprintf("%f", a.TakeoffAngle.Value)
 		am["TimeResidual"] = fmt.Sprintf("%f", a.TimeResidual)
+		am["HorizontalSlownessResidual"] = fmt.Sprintf("%f", a.HorizontalSlownessResidual)
+		am["BackazimuthResidual"] = fmt.Sprintf("%f", a.BackazimuthResidual)
 		am["TimeWeight"] = fmt.Sprintf("%f", a.TimeWeight)
+		am["HorizontalSlownessWeight"] = fmt.Sprintf("%f", a.HorizontalSlownessWeight)
+		am["BackazimuthWeight"] = fmt.Sprintf("%f", a.BackazimuthWeight)
+		am["EarthModelID"] = a.EarthModelID
+		am["Azimuth"] = fmt.Sprintf("%f", a.Azimuth)
+		am["Distance"] = fmt.Sprintf("%f", a.Distance)
+		am["EvaluationMode"] = a.Pick.EvaluationMode
+		am["EvaluationStatus"] = a.Pick.EvaluationStatus
+		// The arrival's creation information or the pick's if the arrival has none.
+		c := a.CreationInfo
+		if c == (CreationInfo{}) {
+			c = a.Pick.CreationInfo
+		}
+		creationInfoMap(am, c)
+		m = append(m, am)
+	}
+
+	return m
+}
+
+// OriginFormat describes the values that are in the map returned by OriginMap.
+// This can be used for query validation and documentation.
+func OriginFormat() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventID"] = "e.g., 2014p072856.  This is the equivalent of the publicID attribute of Event."
+	m["OriginID"] = "the publicID of the Origin."
+	m["IsPreferred"] = "true if this is the PreferredOrigin of the Event."
+	m["OriginTime"] = "e.g., 2012-01-27T04:06:25.369465Z"
+	m["Latitude"] = "e.g., -43.157042"
+	m["LatitudeUncertainty"] = "latitude uncertainty"
+	m["Longitude"] = "e.g., 170.909605"
+	m["LongitudeUncertainty"] = "longitude uncertainty"
+	m["Depth"] = "depth (km)"
+	m["DepthUncertainty"] = "depth uncertainty (km)"
+	m["AssociatedPhaseCount"] = "number of phases associated with the origin"
+	m["UsedPhaseCount"] = "number of phases used to locate the origin"
+	m["AssociatedStationCount"] = "number of stations associated with the origin"
+	m["UsedStationCount"] = "number of stations used to locate the origin"
+	m["StandardError"] = "RMS of the travel time residuals (s)"
+	m["AzimuthalGap"] = "largest azimuthal gap in station distribution (deg)"
+	m["SecondaryAzimuthalGap"] = "largest azimuthal gap filled by a single station (deg)"
+	m["GroundTruthLevel"] = "e.g., GT5"
+	m["MinimumDistance"] = "epicentral distance to the closest station (deg)"
+	m["MedianDistance"] = "median epicentral distance of the stations (deg)"
+	m["MaximumDistance"] = "epicentral distance to the furthest station (deg)"
+	m["HorizontalUncertainty"] = "circular confidence region radius (km)"
+	m["MinHorizontalUncertainty"] = "semi-minor axis of the horizontal confidence ellipse (km)"
+	m["MaxHorizontalUncertainty"] = "semi-major axis of the horizontal confidence ellipse (km)"
+	m["AzimuthMaxHorizontalUncertainty"] = "azimuth of the semi-major axis of the horizontal confidence ellipse (deg)"
+	m["SemiMajorAxisLength"] = "largest semi-axis of the confidence ellipsoid (km)"
+	m["SemiMinorAxisLength"] = "smallest semi-axis of the confidence ellipsoid (km)"
+	m["SemiIntermediateAxisLength"] = "intermediate semi-axis of the confidence ellipsoid (km)"
+	m["MajorAxisPlunge"] = "plunge of the confidence ellipsoid major axis (deg)"
+	m["MajorAxisAzimuth"] = "azimuth of the confidence ellipsoid major axis (deg)"
+	m["MajorAxisRotation"] = "rotation of the confidence ellipsoid about the major axis (deg)"
+	m["ConfidenceLevel"] = "confidence level of the uncertainty (%)"
+	m["PreferredDescription"] = "e.g., confidence ellipsoid"
+	m["MethodID"] = "e.g., NonLinLoc"
+	m["EarthModelID"] = "e.g., nz3drx"
+	m["EvaluationMode"] = "e.g., automatic"
+	m["EvaluationStatus"] = "e.g., confirmed"
+	creationInfoFormat(m)
+	return m
+}
+
+// OriginMap remaps the Origin information in the QuakeML to allow for user selectable output.  Depths and uncertainty
+// lengths are converted from m to km to match SeisCompML.
+func (o *Origin) OriginMap() (m map[string]string) {
+	m = make(map[string]string)
+	m["OriginID"] = o.PublicID
+	m["OriginTime"] = o.Time.Value.Format(time.RFC3339Nano)
+	m["Latitude"] = fmt.Sprintf("%f", o.Latitude.Value)
+	m["LatitudeUncertainty"] = fmt.Sprintf("%f", o.Latitude.Uncertainty)
+	m["Longitude"] = fmt.Sprintf("%f", o.Longitude.Value)
+	m["LongitudeUncertainty"] = fmt.Sprintf("%f", o.Longitude.Uncertainty)
+	m["Depth"] = fmt.Sprintf("%f", o.Depth.Value/1000)
+	m["DepthUncertainty"] = fmt.Sprintf("%f", o.Depth.Uncertainty/1000)
+	m["AssociatedPhaseCount"] = fmt.Sprintf("%d", o.Quality.AssociatedPhaseCount)
+	m["UsedPhaseCount"] = fmt.Sprintf("%d", o.Quality.UsedPhaseCount)
+	m["AssociatedStationCount"] = fmt.Sprintf("%d", o.Quality.AssociatedStationCount)
+	m["UsedStationCount"] = fmt.Sprintf("%d", o.Quality.UsedStationCount)
+	m["StandardError"] = fmt.Sprintf("%f", o.Quality.StandardError)
+	m["AzimuthalGap"] = fmt.Sprintf("%f", o.Quality.AzimuthalGap)
+	m["SecondaryAzimuthalGap"] = fmt.Sprintf("%f", o.Quality.SecondaryAzimuthalGap)
+	m["GroundTruthLevel"] = o.Quality.GroundTruthLevel
+	m["MinimumDistance"] = fmt.Sprintf("%f", o.Quality.MinimumDistance)
+	m["MedianDistance"] = fmt.Sprintf("%f", o.Quality.MedianDistance)
+	m["MaximumDistance"] = fmt.Sprintf("%f", o.Quality.MaximumDistance)
+	m["HorizontalUncertainty"] = fmt.Sprintf("%f", o.Uncertainty.HorizontalUncertainty/1000)
+	m["MinHorizontalUncertainty"] = fmt.Sprintf("%f", o.Uncertainty.MinHorizontalUncertainty/1000)
+	m["MaxHorizontalUncertainty"] = fmt.Sprintf("%f", o.Uncertainty.MaxHorizontalUncertainty/1000)
+	m["AzimuthMaxHorizontalUncertainty"] = fmt.Sprintf("%f", o.Uncertainty.AzimuthMaxHorizontalUncertainty)
+	m["SemiMajorAxisLength"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceEllipsoid.SemiMajorAxisLength/1000)
+	m["SemiMinorAxisLength"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceEllipsoid.SemiMinorAxisLength/1000)
+	m["SemiIntermediateAxisLength"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceEllipsoid.SemiIntermediateAxisLength/1000)
+	m["MajorAxisPlunge"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceEllipsoid.MajorAxisPlunge)
+	m["MajorAxisAzimuth"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceEllipsoid.MajorAxisAzimuth)
+	m["MajorAxisRotation"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceEllipsoid.MajorAxisRotation)
+	m["ConfidenceLevel"] = fmt.Sprintf("%f", o.Uncertainty.ConfidenceLevel)
+	m["PreferredDescription"] = o.Uncertainty.PreferredDescription
+	m["MethodID"] = o.MethodID
+	m["EarthModelID"] = o.EarthModelID
+	m["EvaluationMode"] = o.EvaluationMode
+	m["EvaluationStatus"] = o.EvaluationStatus
+	creationInfoMap(m, o.CreationInfo)
+	return m
+}
+
+// OriginMap remaps the information for all the Origins in the QuakeML to allow for user selectable output.
+func (e *Event) OriginMap() (m []map[string]string) {
+	m = make([]map[string]string, len(e.O))
+
+	for i := range e.O {
+		om := e.O[i].OriginMap()
+		om["IsPreferred"] = fmt.Sprintf("%t", e.O[i].PublicID == e.PreferredOriginID)
+		m[i] = om
+	}
+
+	return m
+}
+
+// MagnitudeFormat describes the values that are in the map returned by MagnitudeMap.
+// This can be used for query validation and documentation.
+func MagnitudeFormat() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventID"] = "e.g., 2014p072856.  This is the equivalent of the publicID attribute of Event."
+	m["MagnitudeID"] = "the publicID of the Magnitude."
+	m["IsPreferred"] = "true if this is the PreferredMagnitude of the Event."
+	m["Type"] = "e.g., MLv"
+	m["Magnitude"] = "e.g., 2.652616"
+	m["Uncertainty"] = "magnitude uncertainty"
+	m["StationCount"] = "number of stations used to calculate the magnitude"
+	m["OriginID"] = "the publicID of the Origin the magnitude was calculated for."
+	m["MethodID"] = "e.g., weighted average"
+	creationInfoFormat(m)
+	return m
+}
+
+// MagnitudeMap remaps the information for all the Magnitudes in the QuakeML to allow for user selectable output.
+func (e *Event) MagnitudeMap() (m []map[string]string) {
+	m = make([]map[string]string, len(e.M))
+
+	for i, mag := range e.M {
+		mm := make(map[string]string)
+		mm["MagnitudeID"] = mag.PublicID
+		mm["IsPreferred"] = fmt.Sprintf("%t", mag.PublicID == e.PreferredMagnitudeID)
+		mm["Type"] = mag.Type
+		mm["Magnitude"] = fmt.Sprintf("%f", mag.Mag.Value)
+		mm["Uncertainty"] = fmt.Sprintf("%f", mag.Mag.Uncertainty)
+		mm["StationCount"] = fmt.Sprintf("%d", mag.StationCount)
+		mm["OriginID"] = mag.OriginID
+		mm["MethodID"] = mag.MethodID
+		creationInfoMap(mm, mag.CreationInfo)
+		m[i] = mm
+	}
+
+	return m
+}
+
+// StationMagnitudeFormat describes the values that are in the map returned by StationMagnitudeMap.
+// This can be used for query validation and documentation.
+func StationMagnitudeFormat() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventID"] = "e.g., 2014p072856.  This is the equivalent of the publicID attribute of Event."
+	m["MagnitudeID"] = "the publicID of the network Magnitude the station magnitude contributes to."
+	m["MagnitudeType"] = "e.g., MLv"
+	m["Magnitude"] = "the network magnitude."
+	m["OriginID"] = "the publicID of the Origin the network magnitude was calculated for."
+	m["StationMagnitudeID"] = "the publicID of the StationMagnitude."
+	m["StationMagnitude"] = "the station magnitude."
+	m["StationMagnitudeType"] = "e.g., MLv"
+	m["AmplitudeID"] = "the publicID of the Amplitude the station magnitude was calculated from."
+	m["NetworkCode"] = "e.g., NZ"
+	m["StationCode"] = "e.g., SNZO"
+	m["ChannelCode"] = "e.g., HHZ"
+	m["LocationCode"] = "e.g., 10"
+	m["Residual"] = "StationMagnitude - Magnitude"
+	m["Weight"] = "weight of the station magnitude in the network magnitude."
+	m["Amplitude"] = "the amplitude the station magnitude was calculated from."
+	m["Period"] = "the period of the amplitude (s)."
+	creationInfoFormat(m)
+	return m
+}
+
+// AmplitudeFormat describes the values that are in the map returned by AmplitudeMap.
+// This can be used for query validation and documentation.
+func AmplitudeFormat() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventID"] = "e.g., 2014p072856.  This is the equivalent of the publicID attribute of Event."
+	m["AmplitudeID"] = "the publicID of the Amplitude."
+	m["Type"] = "e.g., MLv"
+	m["Amplitude"] = "e.g., 0.806412"
+	m["Uncertainty"] = "amplitude uncertainty"
+	m["Unit"] = "e.g., m"
+	m["Period"] = "period (s)"
+	m["SNR"] = "signal to noise ratio"
+	m["TimeWindowReference"] = "e.g., 2012-01-27T04:09:04.83839Z"
+	m["TimeWindowBegin"] = "start of the time window relative to the reference (s)"
+	m["TimeWindowEnd"] = "end of the time window relative to the reference (s)"
+	m["PickID"] = "the publicID of the Pick the amplitude is associated with."
+	m["PhaseHint"] = "e.g., P.  From the associated Pick."
+	m["PhaseTime"] = "e.g., 2012-01-27T04:06:44.54839Z.  From the associated Pick."
+	m["NetworkCode"] = "e.g., NZ"
+	m["StationCode"] = "e.g., SNZO"
+	m["ChannelCode"] = "e.g., HHZ"
+	m["LocationCode"] = "e.g., 10"
+	m["MethodID"] = "method used to measure the amplitude."
+	m["MagnitudeHint"] = "e.g., ML"
+	creationInfoFormat(m)
+	return m
+}
+
+// AmplitudeMap remaps the Amplitude information in the QuakeML to allow for user selectable output.
+func (e *Event) AmplitudeMap() (m []map[string]string) {
+	m = make([]map[string]string, len(e.A))
+
+	for i, a := range e.A {
+		am := make(map[string]string)
+		am["AmplitudeID"] = a.PublicID
+		am["Type"] = a.Type
+		am["Amplitude"] = fmt.Sprintf("%f", a.GenericAmplitude.Value)
+		am["Uncertainty"] = fmt.Sprintf("%f", a.GenericAmplitude.Uncertainty)
+		am["Unit"] = a.Unit
+		am["Period"] = fmt.Sprintf("%f", a.Period.Value)
+		am["SNR"] = fmt.Sprintf("%f", a.SNR)
+		am["TimeWindowReference"] = a.TimeWindow.Reference.Format(time.RFC3339Nano)
+		am["TimeWindowBegin"] = fmt.Sprintf("%f", a.TimeWindow.Begin)
+		am["TimeWindowEnd"] = fmt.Sprintf("%f", a.TimeWindow.End)
+		am["PickID"] = a.PickID
+		am["NetworkCode"] = a.WaveformID.NetworkCode
+		am["StationCode"] = a.WaveformID.StationCode
+		am["ChannelCode"] = a.WaveformID.ChannelCode
+		am["LocationCode"] = a.WaveformID.LocationCode
+		am["MethodID"] = a.MethodID
+		am["MagnitudeHint"] = a.MagnitudeHint
+		if a.Pick != nil {
+			am["PhaseHint"] = a.Pick.PhaseHint
+			am["PhaseTime"] = a.Pick.Time.Value.Format(time.RFC3339Nano)
+		}
+		creationInfoMap(am, a.CreationInfo)
 		m[i] = am
-		i++
+	}
+
+	return m
+}
+
+// StationMagnitudeMap remaps the station magnitude contributions for all Magnitudes in the QuakeML to allow
+// for user selectable output.  Contributions for station magnitudes that are not in the QuakeML are skipped.
+func (e *Event) StationMagnitudeMap() (m []map[string]string) {
+	m = make([]map[string]string, 0)
+
+	for _, mag := range e.M {
+		for _, c := range mag.Contributions {
+			if c.StationMagnitude == nil {
+				continue
+			}
+			sm := c.StationMagnitude
+			mm := make(map[string]string)
+			mm["MagnitudeID"] = mag.PublicID
+			mm["MagnitudeType"] = mag.Type
+			mm["Magnitude"] = fmt.Sprintf("%f", mag.Mag.Value)
+			mm["OriginID"] = mag.OriginID
+			mm["StationMagnitudeID"] = sm.PublicID
+			mm["StationMagnitude"] = fmt.Sprintf("%f", sm.Mag.Value)
+			mm["StationMagnitudeType"] = sm.Type
+			mm["AmplitudeID"] = sm.AmplitudeID
+			mm["NetworkCode"] = sm.WaveformID.NetworkCode
+			mm["StationCode"] = sm.WaveformID.StationCode
+			mm["ChannelCode"] = sm.WaveformID.ChannelCode
+			mm["LocationCode"] = sm.WaveformID.LocationCode
+			mm["Residual"] = fmt.Sprintf("%f", sm.Mag.Value-mag.Mag.Value)
+			mm["Weight"] = fmt.Sprintf("%f", c.Weight)
+			if sm.Amplitude != nil {
+				mm["Amplitude"] = fmt.Sprintf("%f", sm.Amplitude.GenericAmplitude.Value)
+				mm["Period"] = fmt.Sprintf("%f", sm.Amplitude.Period.Value)
+			}
+			creationInfoMap(mm, sm.CreationInfo)
+			m = append(m, mm)
+		}
+	}
+
+	return m
+}
+
+// FocalMechanismFormat describes the values that are in the map returned by FocalMechanismMap.
+// This can be used for query validation and documentation.
+func FocalMechanismFormat() (m map[string]string) {
+	m = make(map[string]string)
+	m["EventID"] = "e.g., 2014p072856.  This is the equivalent of the publicID attribute of Event."
+	m["FocalMechanismID"] = "the publicID of the FocalMechanism."
+	m["IsPreferred"] = "true if this is the preferred FocalMechanism of the Event."
+	m["TriggeringOriginID"] = "the publicID of the Origin that triggered the FocalMechanism."
+	m["Strike1"] = "strike of nodal plane 1 (deg)"
+	m["Dip1"] = "dip of nodal plane 1 (deg)"
+	m["Rake1"] = "rake of nodal plane 1 (deg)"
+	m["Strike2"] = "strike of nodal plane 2 (deg)"
+	m["Dip2"] = "dip of nodal plane 2 (deg)"
+	m["Rake2"] = "rake of nodal plane 2 (deg)"
+	m["PreferredPlane"] = "e.g., 1"
+	m["TAxisAzimuth"] = "azimuth of the T axis (deg)"
+	m["TAxisPlunge"] = "plunge of the T axis (deg)"
+	m["TAxisLength"] = "length of the T axis (Nm)"
+	m["PAxisAzimuth"] = "azimuth of the P axis (deg)"
+	m["PAxisPlunge"] = "plunge of the P axis (deg)"
+	m["PAxisLength"] = "length of the P axis (Nm)"
+	m["NAxisAzimuth"] = "azimuth of the N axis (deg)"
+	m["NAxisPlunge"] = "plunge of the N axis (deg)"
+	m["NAxisLength"] = "length of the N axis (Nm)"
+	m["AzimuthalGap"] = "largest azimuthal gap in the stations used (deg)"
+	m["StationPolarityCount"] = "number of station polarities used"
+	m["Misfit"] = "fraction of misfit polarities"
+	m["MethodID"] = "method used to determine the FocalMechanism."
+	m["EvaluationMode"] = "e.g., manual"
+	m["EvaluationStatus"] = "e.g., reviewed"
+	m["MomentTensorID"] = "the publicID of the first MomentTensor of the FocalMechanism."
+	m["DerivedOriginID"] = "the publicID of the Origin derived from the MomentTensor."
+	m["MomentMagnitudeID"] = "the publicID of the moment Magnitude."
+	m["Mw"] = "e.g., 6.2.  The value of the moment Magnitude."
+	m["ScalarMoment"] = "scalar moment (Nm)"
+	m["Mrr"] = "tensor component (Nm)"
+	m["Mtt"] = "tensor component (Nm)"
+	m["Mpp"] = "tensor component (Nm)"
+	m["Mrt"] = "tensor component (Nm)"
+	m["Mrp"] = "tensor component (Nm)"
+	m["Mtp"] = "tensor component (Nm)"
+	m["VarianceReduction"] = "variance reduction of the inversion (%)"
+	m["DoubleCouple"] = "double couple fraction of the MomentTensor"
+	m["CLVD"] = "compensated linear vector dipole fraction of the MomentTensor"
+	creationInfoFormat(m)
+	return m
+}
+
+// FocalMechanismMap remaps the FocalMechanism information in the QuakeML to allow for user selectable output.
+// The moment tensor values are from the first MomentTensor of each FocalMechanism.
+func (e *Event) FocalMechanismMap() (m []map[string]string) {
+	m = make([]map[string]string, len(e.FM))
+
+	for i, f := range e.FM {
+		fm := make(map[string]string)
+		fm["FocalMechanismID"] = f.PublicID
+		fm["IsPreferred"] = fmt.Sprintf("%t", f.PublicID == e.PreferredFocalMechanismID)
+		fm["TriggeringOriginID"] = f.TriggeringOriginID
+		fm["Strike1"] = fmt.Sprintf("%f", f.NodalPlanes.NodalPlane1.Strike.Value)
+		fm["Dip1"] = fmt.Sprintf("%f", f.NodalPlanes.NodalPlane1.Dip.Value)
+		fm["Rake1"] = fmt.Sprintf("%f", f.NodalPlanes.NodalPlane1.Rake.Value)
+		fm["Strike2"] = fmt.Sprintf("%f", f.NodalPlanes.NodalPlane2.Strike.Value)
+		fm["Dip2"] = fmt.Sprintf("%f", f.NodalPlanes.NodalPlane2.Dip.Value)
+		fm["Rake2"] = fmt.Sprintf("%f", f.NodalPlanes.NodalPlane2.Rake.Value)
+		fm["PreferredPlane"] = fmt.Sprintf("%d", f.NodalPlanes.PreferredPlane)
+		fm["TAxisAzimuth"] = fmt.Sprintf("%f", f.PrincipalAxes.TAxis.Azimuth.Value)
+		fm["TAxisPlunge"] = fmt.Sprintf("%f", f.PrincipalAxes.TAxis.Plunge.Value)
+		fm["TAxisLength"] = fmt.Sprintf("%g", f.PrincipalAxes.TAxis.Length.Value)
+		fm["PAxisAzimuth"] = fmt.Sprintf("%f", f.PrincipalAxes.PAxis.Azimuth.Value)
+		fm["PAxisPlunge"] = fmt.Sprintf("%f", f.PrincipalAxes.PAxis.Plunge.Value)
+		fm["PAxisLength"] = fmt.Sprintf("%g", f.PrincipalAxes.PAxis.Length.Value)
+		fm["NAxisAzimuth"] = fmt.Sprintf("%f", f.PrincipalAxes.NAxis.Azimuth.Value)
+		fm["NAxisPlunge"] = fmt.Sprintf("%f", f.PrincipalAxes.NAxis.Plunge.Value)
+		fm["NAxisLength"] = fmt.Sprintf("%g", f.PrincipalAxes.NAxis.Length.Value)
+		fm["AzimuthalGap"] = fmt.Sprintf("%f", f.AzimuthalGap)
+		fm["StationPolarityCount"] = fmt.Sprintf("%d", f.StationPolarityCount)
+		fm["Misfit"] = fmt.Sprintf("%f", f.Misfit)
+		fm["MethodID"] = f.MethodID
+		fm["EvaluationMode"] = f.EvaluationMode
+		fm["EvaluationStatus"] = f.EvaluationStatus
+
+		if len(f.MomentTensors) > 0 {
+			mt := f.MomentTensors[0]
+			fm["MomentTensorID"] = mt.PublicID
+			fm["DerivedOriginID"] = mt.DerivedOriginID
+			fm["MomentMagnitudeID"] = mt.MomentMagnitudeID
+			if mt.MomentMagnitude != nil {
+				fm["Mw"] = fmt.Sprintf("%f", mt.MomentMagnitude.Mag.Value)
+			}
+			fm["ScalarMoment"] = fmt.Sprintf("%g", mt.ScalarMoment.Value)
+			fm["Mrr"] = fmt.Sprintf("%g", mt.Tensor.Mrr.Value)
+			fm["Mtt"] = fmt.Sprintf("%g", mt.Tensor.Mtt.Value)
+			fm["Mpp"] = fmt.Sprintf("%g", mt.Tensor.Mpp.Value)
+			fm["Mrt"] = fmt.Sprintf("%g", mt.Tensor.Mrt.Value)
+			fm["Mrp"] = fmt.Sprintf("%g", mt.Tensor.Mrp.Value)
+			fm["Mtp"] = fmt.Sprintf("%g", mt.Tensor.Mtp.Value)
+			fm["VarianceReduction"] = fmt.Sprintf("%f", mt.VarianceReduction)
+			fm["DoubleCouple"] = fmt.Sprintf("%f", mt.DoubleCouple)
+			fm["CLVD"] = fmt.Sprintf("%f", mt.CLVD)
+		}
+		creationInfoMap(fm, f.CreationInfo)
+		m[i] = fm
 	}
 
 	return m
@@ -217,14 +935,51 @@ func (q *Quakeml) init() (err error) {
 
 	q.EventParameters.Event.PreferredMagnitude = q.EventParameters.Event.Magnitudes[q.EventParameters.Event.PreferredMagnitudeID]
 
+	q.EventParameters.Event.FocalMechanisms = make(map[string]*FocalMechanism)
+
+	for i, f := range q.EventParameters.Event.FM {
+		for j, mt := range f.MomentTensors {
+			f.MomentTensors[j].MomentMagnitude = q.EventParameters.Event.Magnitudes[mt.MomentMagnitudeID]
+		}
+		q.EventParameters.Event.FocalMechanisms[f.PublicID] = &q.EventParameters.Event.FM[i]
+	}
+
+	q.EventParameters.Event.PreferredFocalMechanism = q.EventParameters.Event.FocalMechanisms[q.EventParameters.Event.PreferredFocalMechanismID]
+
+	q.EventParameters.Event.Amplitudes = make(map[string]*Amplitude)
+
+	for i, a := range q.EventParameters.Event.A {
+		q.EventParameters.Event.Amplitudes[a.PublicID] = &q.EventParameters.Event.A[i]
+	}
+
+	q.EventParameters.Event.StationMagnitudes = make(map[string]*StationMagnitude)
+
+	for i, sm := range q.EventParameters.Event.SM {
+		q.EventParameters.Event.SM[i].Amplitude = q.EventParameters.Event.Amplitudes[sm.AmplitudeID]
+		q.EventParameters.Event.StationMagnitudes[sm.PublicID] = &q.EventParameters.Event.SM[i]
+	}
+
+	for _, magnitude := range q.EventParameters.Event.M {
+		for i, c := range magnitude.Contributions {
+			magnitude.Contributions[i].StationMagnitude = q.EventParameters.Event.StationMagnitudes[c.StationMagnitudeID]
+		}
+	}
+
 	q.EventParameters.Event.Picks = make(map[string]*Pick)
 
 	for i, pick := range q.EventParameters.Event.P {
 		q.EventParameters.Event.Picks[pick.PublicID] = &q.EventParameters.Event.P[i]
 	}
 
-	for i, a := range q.EventParameters.Event.PreferredOrigin.Arrivals {
-		q.EventParameters.Event.PreferredOrigin.Arrivals[i].Pick = q.EventParameters.Event.Picks[a.PickID]
+	for i, a := range q.EventParameters.Event.A {
+		q.EventParameters.Event.A[i].Pick = q.EventParameters.Event.Picks[a.PickID]
+	}
+
+	// The preferred origin is nil if preferredOriginID is not one of the origins.
+	if q.EventParameters.Event.PreferredOrigin != nil {
+		for i, a := range q.EventParameters.Event.PreferredOrigin.Arrivals {
+			q.EventParameters.Event.PreferredOrigin.Arrivals[i].Pick = q.EventParameters.Event.Picks[a.PickID]
+		}
 	}
 
 	return
@@ -246,6 +1001,7 @@ type result struct {
 	event    Event
 	publicID string
 	err      error
+	cacheErr error
 }
 
 // Fetcher reads eventids, fetches, unmarshals, and returns QuakeML.
@@ -254,33 +1010,64 @@ func fetcher(done <-chan struct{}, eventids <-chan string, c chan<- result) {
 
 	for publicid := range eventids {
 
-		var b []byte
 		var e Event
 
-		r, err := client.Get(quakeMLUrl + publicid)
-		defer r.Body.Close()
+		b, cached, err := fetch(client, publicid)
 
 		if err == nil {
-			b, err = ioutil.ReadAll(r.Body)
+			e, err = unmarshal(b)
 		}
 
-		if err == nil && r.StatusCode != 200 {
-			err = errors.New(fmt.Sprintf("Non 200 response code: %d", r.StatusCode))
-		}
+		var cacheErr error
 
-		if err == nil {
-			e, err = unmarshal(b)
+		if err == nil && !cached && CacheDir != "" {
+			cacheErr = cache(publicid, b)
 		}
 
 		select {
-		case c <- result{e, publicid, err}:
+		case c <- result{e, publicid, err, cacheErr}:
 		case <-done:
 			return
 		}
 	}
 }
 
-// Get retrives QuakeML for each EventID.  Errors are logged but not returned.
+// fetch returns the QuakeML for publicid from CacheDir if it is there, otherwise from URL.
+func fetch(client *http.Client, publicid string) (b []byte, cached bool, err error) {
+	if CacheDir != "" {
+		if b, err = ioutil.ReadFile(filepath.Join(CacheDir, publicid+".xml")); err == nil {
+			return b, true, nil
+		}
+	}
+
+	r, err := client.Get(URL + publicid)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != 200 {
+		return nil, false, errors.New(fmt.Sprintf("Non 200 response code: %d", r.StatusCode))
+	}
+
+	b, err = ioutil.ReadAll(r.Body)
+
+	return b, false, err
+}
+
+// cache saves the QuakeML b for publicid in CacheDir.
+func cache(publicid string, b []byte) error {
+	if err := os.MkdirAll(CacheDir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(CacheDir, publicid+".xml"), b, 0644)
+}
+
+// Progress is called as the details for each quake are fetched.
+var Progress progress.Func = progress.Log
+
+// Get retrives QuakeML for each EventID.  Errors are sent to Progress but not returned.
 func Get(eventid []string) (quakeml map[string]Event) {
 	done := make(chan struct{})
 	defer close(done)
@@ -315,19 +1102,18 @@ func Get(eventid []string) (quakeml map[string]Event) {
 	}()
 
 	quakeml = make(map[string]Event)
-	var i = 0
+	n := 0
 	for r := range c {
-		if r.err != nil {
-			log.Println("Error fetching data for " + r.publicID)
-			log.Println(r.err)
-		} else {
-			quakeml[r.publicID] = r.event
-			i++
+		n++
+		if r.cacheErr != nil {
+			Progress(progress.Event{Source: "quakeml12", Kind: progress.Warning, EventID: r.publicID, Err: r.cacheErr})
 		}
-		if i == 50 {
-			log.Printf("Downloaded %v quakes", len(quakeml))
-			i = 0
+		if r.err != nil {
+			Progress(progress.Event{Source: "quakeml12", Kind: progress.Error, EventID: r.publicID, Done: n, Total: len(eventid), Err: r.err})
+			continue
 		}
+		quakeml[r.publicID] = r.event
+		Progress(progress.Event{Source: "quakeml12", Kind: progress.Quakes, EventID: r.publicID, Done: n, Total: len(eventid)})
 	}
 	return quakeml
 }
@@ -1,6 +1,7 @@
 package quakeml12
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -70,6 +71,28 @@ func TestUnmarshal(t *testing.T) {
 		t.Error("Pick.Time.Value expected 2012-01-27T04:06:29.798393Z, got ", e.Picks["smi:scs/0.7/20120127.040629.79-AIC-NZ.WVZ.10.HHZ"].Time)
 	}
 
+	ci := e.Picks["smi:scs/0.7/20120127.040629.79-AIC-NZ.WVZ.10.HHZ"].CreationInfo
+	if ci.Author != "scautopick@seiscomp3vm_1" {
+		t.Error("Pick.CreationInfo.Author expected scautopick@seiscomp3vm_1, got ", ci.Author)
+	}
+	if ci.AgencyID != "WEL(GNS_Primary)" {
+		t.Error("Pick.CreationInfo.AgencyID expected WEL(GNS_Primary), got ", ci.AgencyID)
+	}
+
+	for _, v := range e.PickMap() {
+		if v["PhaseTime"] == "2012-01-27T04:06:29.798393Z" && v["CreationTime"] != "2013-12-02T03:38:18.51576Z" {
+			t.Error("PickMap CreationTime expected 2013-12-02T03:38:18.51576Z, got ", v["CreationTime"])
+		}
+		if v["ModificationTime"] != "" {
+			t.Error("PickMap ModificationTime expected empty, got ", v["ModificationTime"])
+		}
+	}
+
+	if e.PreferredOrigin.CreationInfo.Author != "screloc@vm-scz02-av.geonet.org.nz" {
+		t.Error("PreferredOrigin.CreationInfo.Author expected screloc@vm-scz02-av.geonet.org.nz, got ",
+			e.PreferredOrigin.CreationInfo.Author)
+	}
+
 	if e.PreferredMagnitude.Type != "M" {
 		t.Error("e.PreferredMagnitude.Type expected M, got ", e.PreferredMagnitude.Type)
 	}
@@ -85,6 +108,403 @@ func TestUnmarshal(t *testing.T) {
 	if e.PreferredMagnitude.MethodID != "smi:scs/0.7/weighted_average" {
 		t.Error("e.PreferredMagnitude.MethodID expected smi:scs/0.7/weighted_average, got ", e.PreferredMagnitude.MethodID)
 	}
+	if e.PreferredOrigin.Latitude.Value != -43.15704211 {
+		t.Error("e.PreferredOrigin.Latitude.Value expected -43.15704211, got ", e.PreferredOrigin.Latitude.Value)
+	}
+	if e.PreferredOrigin.Longitude.Uncertainty != 22.62652012 {
+		t.Error("e.PreferredOrigin.Longitude.Uncertainty expected 22.62652012, got ", e.PreferredOrigin.Longitude.Uncertainty)
+	}
+	if e.PreferredOrigin.Depth.Value != 5234.375 {
+		t.Error("e.PreferredOrigin.Depth.Value expected 5234.375, got ", e.PreferredOrigin.Depth.Value)
+	}
+	if e.PreferredOrigin.Quality.UsedPhaseCount != 8 {
+		t.Error("e.PreferredOrigin.Quality.UsedPhaseCount expected 8, got ", e.PreferredOrigin.Quality.UsedPhaseCount)
+	}
+	if e.PreferredOrigin.Quality.StandardError != 0.5944258933 {
+		t.Error("e.PreferredOrigin.Quality.StandardError expected 0.5944258933, got ", e.PreferredOrigin.Quality.StandardError)
+	}
+	if e.PreferredOrigin.Quality.SecondaryAzimuthalGap != 139.821084 {
+		t.Error("e.PreferredOrigin.Quality.SecondaryAzimuthalGap expected 139.821084, got ", e.PreferredOrigin.Quality.SecondaryAzimuthalGap)
+	}
+	if e.PreferredOrigin.Quality.MedianDistance != 0.9638177977 {
+		t.Error("e.PreferredOrigin.Quality.MedianDistance expected 0.9638177977, got ", e.PreferredOrigin.Quality.MedianDistance)
+	}
+
+	om := e.PreferredOrigin.OriginMap()
+	if om["Depth"] != "5.234375" {
+		t.Error("OriginMap Depth expected 5.234375, got ", om["Depth"])
+	}
+	if om["MaximumDistance"] != "1.893295" {
+		t.Error("OriginMap MaximumDistance expected 1.893295, got ", om["MaximumDistance"])
+	}
+	if e.PreferredOrigin.Uncertainty.MaxHorizontalUncertainty != 61.4939541 {
+		t.Error("Uncertainty.MaxHorizontalUncertainty expected 61.4939541, got ", e.PreferredOrigin.Uncertainty.MaxHorizontalUncertainty)
+	}
+	if e.PreferredOrigin.Uncertainty.ConfidenceEllipsoid.MajorAxisAzimuth != 80.48783797 {
+		t.Error("ConfidenceEllipsoid.MajorAxisAzimuth expected 80.48783797, got ",
+			e.PreferredOrigin.Uncertainty.ConfidenceEllipsoid.MajorAxisAzimuth)
+	}
+	if om["MaxHorizontalUncertainty"] != "0.061494" {
+		t.Error("OriginMap MaxHorizontalUncertainty expected 0.061494, got ", om["MaxHorizontalUncertainty"])
+	}
+	if om["SemiMajorAxisLength"] != "0.087311" {
+		t.Error("OriginMap SemiMajorAxisLength expected 0.087311, got ", om["SemiMajorAxisLength"])
+	}
+	if e.PreferredOrigin.MethodID != "smi:scs/0.7/NonLinLoc" {
+		t.Error("e.PreferredOrigin.MethodID expected smi:scs/0.7/NonLinLoc, got ", e.PreferredOrigin.MethodID)
+	}
+	if e.PreferredOrigin.EvaluationMode != "automatic" {
+		t.Error("e.PreferredOrigin.EvaluationMode expected automatic, got ", e.PreferredOrigin.EvaluationMode)
+	}
+
+	oms := e.OriginMap()
+	if len(oms) != 4 {
+		t.Error("OriginMap expected 4 origins, got ", len(oms))
+	}
+	p := 0
+	for _, v := range oms {
+		if v["IsPreferred"] == "true" {
+			p++
+			if v["OriginID"] != e.PreferredOriginID {
+				t.Error("OriginMap IsPreferred for wrong origin ", v["OriginID"])
+			}
+		}
+	}
+	if p != 1 {
+		t.Error("OriginMap expected 1 preferred origin, got ", p)
+	}
+
+	mms := e.MagnitudeMap()
+	if len(mms) != len(e.M) {
+		t.Error("MagnitudeMap expected ", len(e.M), " magnitudes, got ", len(mms))
+	}
+	for _, v := range mms {
+		if v["MagnitudeID"] == "smi:scs/0.7/NLL.20140109110100.055987.14584#netMag.M" {
+			if v["IsPreferred"] != "true" {
+				t.Error("MagnitudeMap IsPreferred expected true for smi:scs/0.7/NLL.20140109110100.055987.14584#netMag.M")
+			}
+			if v["OriginID"] != "" {
+				t.Error("MagnitudeMap OriginID expected , got ", v["OriginID"])
+			}
+		} else if v["IsPreferred"] != "false" {
+			t.Error("MagnitudeMap IsPreferred expected false for ", v["MagnitudeID"])
+		}
+	}
+	if len(e.SM) != 34 {
+		t.Error("expected 34 station magnitudes, got ", len(e.SM))
+	}
+
+	sm := e.StationMagnitudes["smi:scs/0.7/NLL.20140109110100.055987.14584#staMag.MLv#NZ.FOZ"]
+	if sm == nil {
+		t.Fatal("missing station magnitude for NZ.FOZ")
+	}
+	if sm.Mag.Value != 2.906556851 {
+		t.Error("sm.Mag.Value expected 2.906556851, got ", sm.Mag.Value)
+	}
+	if sm.AmplitudeID != "smi:scs/0.7/20120127.040644.54-AIC-NZ.FOZ.10.HHZ.MLv" {
+		t.Error("sm.AmplitudeID expected smi:scs/0.7/20120127.040644.54-AIC-NZ.FOZ.10.HHZ.MLv, got ", sm.AmplitudeID)
+	}
+	if sm.WaveformID.StationCode != "FOZ" {
+		t.Error("sm.WaveformID.StationCode expected FOZ, got ", sm.WaveformID.StationCode)
+	}
+
+	ml := e.Magnitudes["smi:scs/0.7/NLL.20140109110100.055987.14584#netMag.MLv"]
+	if len(ml.Contributions) != 7 {
+		t.Error("expected 7 contributions, got ", len(ml.Contributions))
+	}
+	if ml.Contributions[0].StationMagnitude != sm {
+		t.Error("Contributions[0] not linked to the station magnitude for NZ.FOZ")
+	}
+	if ml.Contributions[0].Weight != 1 {
+		t.Error("Contributions[0].Weight expected 1, got ", ml.Contributions[0].Weight)
+	}
+
+	if len(e.A) != 34 {
+		t.Error("expected 34 amplitudes, got ", len(e.A))
+	}
+
+	if sm.Amplitude == nil {
+		t.Fatal("sm.Amplitude not linked for NZ.FOZ")
+	}
+	if sm.Amplitude.GenericAmplitude.Value != 0.8064117578 {
+		t.Error("sm.Amplitude.GenericAmplitude.Value expected 0.8064117578, got ", sm.Amplitude.GenericAmplitude.Value)
+	}
+	if sm.Amplitude.SNR != 2.561924298 {
+		t.Error("sm.Amplitude.SNR expected 2.561924298, got ", sm.Amplitude.SNR)
+	}
+	if sm.Amplitude.Pick != e.Picks["smi:scs/0.7/20120127.040644.54-AIC-NZ.FOZ.10.HHZ"] {
+		t.Error("sm.Amplitude.Pick not linked to the pick for NZ.FOZ")
+	}
+
+	for _, v := range e.AmplitudeMap() {
+		if v["AmplitudeID"] == sm.AmplitudeID {
+			if v["TimeWindowReference"] != "2012-01-27T04:09:04.83839Z" {
+				t.Error("AmplitudeMap TimeWindowReference expected 2012-01-27T04:09:04.83839Z, got ", v["TimeWindowReference"])
+			}
+			if v["PhaseHint"] != "P" {
+				t.Error("AmplitudeMap PhaseHint expected P, got ", v["PhaseHint"])
+			}
+		}
+	}
+
+	smm := e.StationMagnitudeMap()
+	if len(smm) == 0 {
+		t.Fatal("StationMagnitudeMap returned no contributions")
+	}
+	for _, v := range smm {
+		if v["StationMagnitudeID"] == sm.PublicID && v["MagnitudeID"] == ml.PublicID && v["Residual"] != "0.253941" {
+			t.Error("StationMagnitudeMap Residual expected 0.253941, got ", v["Residual"])
+		}
+	}
+}
+
+func TestUnmarshalFocalMechanism(t *testing.T) {
+	xmlFile, err := os.Open("etc/all-fields.xml")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	defer xmlFile.Close()
+
+	b, _ := ioutil.ReadAll(xmlFile)
+
+	e, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.PreferredFocalMechanism == nil {
+		t.Fatal("PreferredFocalMechanism not linked")
+	}
+
+	f := e.PreferredFocalMechanism
+	if f.NodalPlanes.NodalPlane1.Strike.Value != 35 {
+		t.Error("NodalPlane1.Strike expected 35, got ", f.NodalPlanes.NodalPlane1.Strike.Value)
+	}
+	if f.NodalPlanes.NodalPlane2.Rake.Value != 59.35765795 {
+		t.Error("NodalPlane2.Rake expected 59.35765795, got ", f.NodalPlanes.NodalPlane2.Rake.Value)
+	}
+	if f.NodalPlanes.PreferredPlane != 1 {
+		t.Error("PreferredPlane expected 1, got ", f.NodalPlanes.PreferredPlane)
+	}
+	if f.PrincipalAxes.PAxis.Plunge.Value != 12.81997608 {
+		t.Error("PAxis.Plunge expected 12.81997608, got ", f.PrincipalAxes.PAxis.Plunge.Value)
+	}
+	if len(f.MomentTensors) != 1 {
+		t.Fatal("expected 1 moment tensor, got ", len(f.MomentTensors))
+	}
+	if f.MomentTensors[0].Tensor.Mrr.Value != 2.0442e+18 {
+		t.Error("Tensor.Mrr expected 2.0442e+18, got ", f.MomentTensors[0].Tensor.Mrr.Value)
+	}
+	if f.MomentTensors[0].MomentMagnitude != e.Magnitudes["smi:nz.org.geonet/Origin#20150101120000.000000.3#netMag.Mw"] {
+		t.Error("MomentMagnitude not linked to the Mw magnitude")
+	}
+
+	fms := e.FocalMechanismMap()
+	if len(fms) != 1 {
+		t.Fatal("FocalMechanismMap expected 1 focal mechanism, got ", len(fms))
+	}
+	if fms[0]["IsPreferred"] != "true" {
+		t.Error("FocalMechanismMap IsPreferred expected true, got ", fms[0]["IsPreferred"])
+	}
+	if fms[0]["Mw"] != "6.200000" {
+		t.Error("FocalMechanismMap Mw expected 6.200000, got ", fms[0]["Mw"])
+	}
+	if fms[0]["ScalarMoment"] != "2.511886432e+18" {
+		t.Error("FocalMechanismMap ScalarMoment expected 2.511886432e+18, got ", fms[0]["ScalarMoment"])
+	}
+	if fms[0]["Dip1"] != "60.000000" {
+		t.Error("FocalMechanismMap Dip1 expected 60.000000, got ", fms[0]["Dip1"])
+	}
+}
+
+func TestPickMap(t *testing.T) {
+	xmlFile, err := os.Open("etc/all-fields.xml")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	defer xmlFile.Close()
+
+	b, _ := ioutil.ReadAll(xmlFile)
+
+	e, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := e.Picks["smi:nz.org.geonet/20150101120002.123456-AIC-NZ.WEL.10.HHZ"]
+	if p == nil {
+		t.Fatal("missing pick for NZ.WEL")
+	}
+	if p.Time.UpperUncertainty != 0.1 {
+		t.Error("Pick.Time.UpperUncertainty expected 0.1, got ", p.Time.UpperUncertainty)
+	}
+	if p.Backazimuth.Value != 212.4 {
+		t.Error("Pick.Backazimuth.Value expected 212.4, got ", p.Backazimuth.Value)
+	}
+
+	pm := e.PickMap()
+	if len(pm) != 1 {
+		t.Fatal("PickMap expected 1 pick, got ", len(pm))
+	}
+
+	for k, v := range map[string]string{
+		"PickID":               p.PublicID,
+		"TimeLowerUncertainty": "0.050000",
+		"TimeUpperUncertainty": "0.100000",
+		"MethodID":             "smi:nz.org.geonet/AIC",
+		"Polarity":             "positive",
+		"Onset":                "impulsive",
+		"HorizontalSlowness":   "12.500000",
+		"SlownessMethodID":     "smi:nz.org.geonet/fk",
+		"EvaluationMode":       "manual",
+		"EvaluationStatus":     "confirmed",
+	} {
+		if pm[0][k] != v {
+			t.Error("PickMap "+k+" expected "+v+", got ", pm[0][k])
+		}
+	}
+}
+
+func TestArrivalMap(t *testing.T) {
+	xmlFile, err := os.Open("etc/all-fields.xml")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	defer xmlFile.Close()
+
+	b, _ := ioutil.ReadAll(xmlFile)
+
+	e, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.PreferredOrigin.Arrivals) != 1 {
+		t.Fatal("Arrivals expected 1, got ", len(e.PreferredOrigin.Arrivals))
+	}
+
+	a := e.PreferredOrigin.Arrivals[0]
+	if a.TakeoffAngle.Value != 135.2 {
+		t.Error("Arrival.TakeoffAngle.Value expected 135.2, got ", a.TakeoffAngle.Value)
+	}
+	if a.TimeWeight != 0.9 {
+		t.Error("Arrival.TimeWeight expected 0.9, got ", a.TimeWeight)
+	}
+	if a.HorizontalSlownessWeight != 0 {
+		t.Error("Arrival.HorizontalSlownessWeight expected 0, got ", a.HorizontalSlownessWeight)
+	}
+	if a.BackazimuthWeight != 0.9 {
+		t.Error("Arrival.BackazimuthWeight expected 0.9, got ", a.BackazimuthWeight)
+	}
+
+	am := e.PreferredOrigin.ArrivalMap()
+	if len(am) != 1 {
+		t.Fatal("ArrivalMap expected 1 arrival, got ", len(am))
+	}
+
+	m := am[0]
+	if m["TimeCorrection"] != "0.050000" {
+		t.Error("TimeCorrection expected 0.050000, got ", m["TimeCorrection"])
+	}
+	if m["BackazimuthResidual"] != "-4.500000" {
+		t.Error("BackazimuthResidual expected -4.500000, got ", m["BackazimuthResidual"])
+	}
+	if m["HorizontalSlownessResidual"] != "0.800000" {
+		t.Error("HorizontalSlownessResidual expected 0.800000, got ", m["HorizontalSlownessResidual"])
+	}
+	if m["Distance"] != "0.210000" {
+		t.Error("Distance expected 0.210000, got ", m["Distance"])
+	}
+	for k := range ArrivalFormat() {
+		if _, ok := m[k]; !ok && k != "EventID" {
+			t.Error("ArrivalMap missing key ", k)
+		}
+	}
+
+	// The creation information is the arrival's or the pick's if the arrival has none.
+	pick := &Pick{CreationInfo: CreationInfo{AgencyID: "WEL(GNS_Primary)", Author: "scautopick"}}
+	o := Origin{Arrivals: []Arrival{
+		{Phase: "P", Pick: pick, CreationInfo: CreationInfo{AgencyID: "WEL(GNS_Test)", Author: "scautoloc"}},
+		{Phase: "S", Pick: pick},
+	}}
+	am = o.ArrivalMap()
+	if len(am) != 2 {
+		t.Fatal("ArrivalMap expected 2 arrivals, got ", len(am))
+	}
+	if am[0]["AgencyID"] != "WEL(GNS_Test)" || am[0]["Author"] != "scautoloc" {
+		t.Error("expected the arrival creation information, got ", am[0]["AgencyID"], am[0]["Author"])
+	}
+	if am[1]["AgencyID"] != "WEL(GNS_Primary)" || am[1]["Author"] != "scautopick" {
+		t.Error("expected the pick creation information, got ", am[1]["AgencyID"], am[1]["Author"])
+	}
+
+	// Arrivals for picks that are not in the document are skipped.
+	o = Origin{Arrivals: []Arrival{{PickID: "missing", Phase: "P"}}}
+	if am = o.ArrivalMap(); len(am) != 0 {
+		t.Error("ArrivalMap expected no arrivals for a missing pick, got ", len(am))
+	}
+}
+
+func TestEventMap(t *testing.T) {
+	xmlFile, err := os.Open("etc/all-fields.xml")
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		return
+	}
+	defer xmlFile.Close()
+
+	b, _ := ioutil.ReadAll(xmlFile)
+
+	e, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Descriptions) != 2 {
+		t.Error("Descriptions expected 2, got ", len(e.Descriptions))
+	}
+	if len(e.Comments) != 2 {
+		t.Error("Comments expected 2, got ", len(e.Comments))
+	}
+
+	m := e.EventMap()
+	if m["EventType"] != "earthquake" {
+		t.Error("EventType expected earthquake, got ", m["EventType"])
+	}
+	if m["EventTypeCertainty"] != "known" {
+		t.Error("EventTypeCertainty expected known, got ", m["EventTypeCertainty"])
+	}
+	if m["Description"] != "20 km north of Wellington" {
+		t.Error("Description expected 20 km north of Wellington, got ", m["Description"])
+	}
+	if m["Comment"] != "Felt widely in the Wellington region; Moment tensor reviewed" {
+		t.Error("Comment incorrect, got ", m["Comment"])
+	}
+	for k := range EventFormat() {
+		if _, ok := m[k]; !ok {
+			t.Error("EventMap missing key ", k)
+		}
+	}
+}
+
+func TestFetchCache(t *testing.T) {
+	CacheDir = "etc"
+	defer func() { CacheDir = "" }()
+
+	b, cached, err := fetch(nil, "2012p070732")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached {
+		t.Error("expected 2012p070732 to be read from the cache")
+	}
+
+	if _, err = unmarshal(b); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestUnmarshalBad(t *testing.T) {
@@ -118,3 +538,26 @@ func TestUnmarshalEmpty(t *testing.T) {
 		t.Error("should have got an error")
 	}
 }
+
+func TestUnmarshalUnknownPreferredOrigin(t *testing.T) {
+	b, err := ioutil.ReadFile("etc/2012p070732.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = bytes.Replace(b, []byte("<preferredOriginID>smi:scs/0.7/NLL.20140109110100.055987.14584</preferredOriginID>"),
+		[]byte("<preferredOriginID>missing</preferredOriginID>"), 1)
+
+	e, err := unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.PreferredOrigin != nil {
+		t.Error("expected no preferred origin")
+	}
+
+	if len(e.Picks) == 0 {
+		t.Error("expected picks without a preferred origin")
+	}
+}
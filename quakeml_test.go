@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQMLEventFor(t *testing.T) {
+	p := wfs.Properties{
+		PublicID:         "2014p549333",
+		EventType:        "earthquake",
+		OriginTime:       "2014-07-23T06:04:43.625Z",
+		Latitude:         -41.5,
+		Longitude:        174.25,
+		Depth:            12.5,
+		DepthType:        "from location",
+		EvaluationMode:   "manual",
+		UsedPhaseCount:   20,
+		AzimuthalGap:     90,
+		MagnitudeType:    "ML",
+		Magnitude:        2.64,
+		EvaluationStatus: "confirmed",
+	}
+
+	o := &seiscompml07.Origin{
+		PublicID:         "Origin#1",
+		Time:             seiscompml07.TimeValue{Value: time.Date(2014, 7, 23, 6, 4, 44, 0, time.UTC)},
+		Latitude:         seiscompml07.Value{Value: -41.6},
+		Longitude:        seiscompml07.Value{Value: 174.3},
+		Depth:            seiscompml07.Value{Value: 10, Uncertainty: 2.5},
+		EvaluationMode:   "automatic",
+		Quality:          seiscompml07.Quality{UsedPhaseCount: 8, AzimuthalGap: 180},
+		CreationInfo:     seiscompml07.CreationInfo{Author: "scautoloc"},
+		EvaluationStatus: "preliminary",
+	}
+
+	m := &seiscompml07.Magnitude{
+		PublicID:     "Magnitude#1",
+		Mag:          seiscompml07.Mag{Value: 2.7, Uncertainty: 0.2},
+		Type:         "M",
+		OriginID:     "Origin#1",
+		StationCount: 6,
+	}
+
+	for _, v := range []struct {
+		name                    string
+		d                       seiscompml07.Event
+		originID, time, mode    string
+		depth, depthUncertainty float64
+		phases                  int
+		magnitudeID, magType    string
+		mag                     float64
+		magOriginID             string
+	}{
+		{"no details", seiscompml07.Event{},
+			"smi:nz.org.geonet/2014p549333/origin", "2014-07-23T06:04:43.625Z", "manual", 12500, 0, 20,
+			"smi:nz.org.geonet/2014p549333/magnitude", "ML", 2.64, "smi:nz.org.geonet/2014p549333/origin"},
+		{"no preferred origin", seiscompml07.Event{PreferredMagnitude: m},
+			"smi:nz.org.geonet/2014p549333/origin", "2014-07-23T06:04:43.625Z", "manual", 12500, 0, 20,
+			"smi:nz.org.geonet/Magnitude#1", "M", 2.7, "smi:nz.org.geonet/Origin#1"},
+		{"preferred origin", seiscompml07.Event{PreferredOrigin: o, PreferredMagnitude: m},
+			"smi:nz.org.geonet/Origin#1", "2014-07-23T06:04:44Z", "automatic", 10000, 2500, 8,
+			"smi:nz.org.geonet/Magnitude#1", "M", 2.7, "smi:nz.org.geonet/Origin#1"},
+	} {
+		e := qmlEventFor(p, v.d)
+
+		if e.PreferredOriginID != v.originID || e.Origin.PublicID != v.originID {
+			t.Errorf("%s: origin expected %s, got %s %s", v.name, v.originID, e.PreferredOriginID, e.Origin.PublicID)
+		}
+
+		if e.Origin.Time.Value != v.time {
+			t.Errorf("%s: time expected %s, got %s", v.name, v.time, e.Origin.Time.Value)
+		}
+
+		// The origin is entirely from one source.
+		if e.Origin.EvaluationMode != v.mode || e.Origin.Quality.UsedPhaseCount != v.phases {
+			t.Errorf("%s: expected evaluation mode %s and used phases %d, got %s %d", v.name, v.mode, v.phases,
+				e.Origin.EvaluationMode, e.Origin.Quality.UsedPhaseCount)
+		}
+
+		// Depths are in m.
+		if e.Origin.Depth.Value != v.depth || e.Origin.Depth.Uncertainty != v.depthUncertainty {
+			t.Errorf("%s: depth expected %v ± %v, got %v ± %v", v.name, v.depth, v.depthUncertainty,
+				e.Origin.Depth.Value, e.Origin.Depth.Uncertainty)
+		}
+
+		if e.Magnitude == nil {
+			t.Errorf("%s: expected a magnitude", v.name)
+			continue
+		}
+
+		if e.PreferredMagnitudeID != v.magnitudeID || e.Magnitude.PublicID != v.magnitudeID {
+			t.Errorf("%s: magnitude expected %s, got %s %s", v.name, v.magnitudeID, e.PreferredMagnitudeID, e.Magnitude.PublicID)
+		}
+
+		if e.Magnitude.Type != v.magType || e.Magnitude.Mag.Value != v.mag || e.Magnitude.OriginID != v.magOriginID {
+			t.Errorf("%s: magnitude expected %s %v for %s, got %s %v for %s", v.name, v.magType, v.mag, v.magOriginID,
+				e.Magnitude.Type, e.Magnitude.Mag.Value, e.Magnitude.OriginID)
+		}
+	}
+
+	// Without a magnitude there is no preferred magnitude.
+	p.MagnitudeType = ""
+
+	if e := qmlEventFor(p, seiscompml07.Event{}); e.Magnitude != nil || e.PreferredMagnitudeID != "" {
+		t.Error("expected no magnitude, got ", e.PreferredMagnitudeID)
+	}
+}
+
+func TestWriteQuakeML(t *testing.T) {
+	res := results{
+		props: []wfs.Properties{{PublicID: "2014p549333", OriginTime: "2014-07-23T06:04:43.625Z", Depth: 12.5}},
+	}
+
+	var b bytes.Buffer
+
+	if err := writeQuakeML(&b, res); err != nil {
+		t.Fatal(err)
+	}
+
+	s := b.String()
+
+	for _, v := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<q:quakeml xmlns:q="http://quakeml.org/xmlns/quakeml/1.2" xmlns="http://quakeml.org/xmlns/bed/1.2">`,
+		`<event publicID="smi:nz.org.geonet/2014p549333">`,
+		`<preferredOriginID>smi:nz.org.geonet/2014p549333/origin</preferredOriginID>`,
+		`<origin publicID="smi:nz.org.geonet/2014p549333/origin">`,
+		`<value>12500</value>`,
+	} {
+		if !strings.Contains(s, v) {
+			t.Error("expected ", v, " in the QuakeML")
+		}
+	}
+
+	if strings.Contains(s, "<magnitude") {
+		t.Error("expected no magnitude in the QuakeML")
+	}
+}
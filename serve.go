@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/GeoNet/qsearch/wfs"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default formats for the HTTP API when no format parameter is given.
+const (
+	defaultPickFormat    = "EventID,NetworkCode,StationCode,LocationCode,ChannelCode,PhaseHint,PhaseTime,EvaluationMode"
+	defaultArrivalFormat = "EventID,NetworkCode,StationCode,LocationCode,ChannelCode,Phase,PhaseTime,TimeResidual,TimeWeight"
+)
+
+// server serves the event, pick, and arrival searches over HTTP.  searches limits the number of
+// searches that run at the same time.  Up to maxResponses responses are cached for ttl.  search is
+// searchQuakes except in the tests.
+type server struct {
+	searches     chan struct{}
+	ttl          time.Duration
+	maxResponses int
+	search       func(query wfs.Query) ([]wfs.Properties, error)
+	mu           sync.Mutex
+	cache        map[string]response
+}
+
+// response is a cached HTTP response.
+type response struct {
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// endpoint describes one of the searches served over HTTP.  selected enables the output in o and
+// returns its format setting.  If filters is true the Pick and agency filters can be used.
+type endpoint struct {
+	format        map[string]string
+	defaultFormat string
+	filters       bool
+	selected      func(o *outputs) *string
+	rows          func(r results) []map[string]string
+}
+
+// endpoints are the searches served over HTTP.
+var endpoints = map[string]endpoint{
+	"events": {
+		format:        eventFormat,
+		defaultFormat: defaultEventFormat,
+		selected:      func(o *outputs) *string { o.event = true; return &o.eventF },
+		rows:          func(r results) []map[string]string { return r.quakes },
+	},
+	"picks": {
+		format:        pickFormat,
+		defaultFormat: defaultPickFormat,
+		filters:       true,
+		selected:      func(o *outputs) *string { o.picks = true; return &o.picksF },
+		rows:          func(r results) []map[string]string { return r.picks },
+	},
+	"arrivals": {
+		format:        arrivalFormat,
+		defaultFormat: defaultArrivalFormat,
+		filters:       true,
+		selected:      func(o *outputs) *string { o.poArrivals = true; return &o.arrivalsF },
+		rows:          func(r results) []map[string]string { return r.arrivals },
+	},
+}
+
+// serveCommand serves the event, pick, and arrival searches over HTTP.
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	var listen string
+	var maxSearches, maxResponses int
+	var ttl time.Duration
+
+	fs.StringVar(&listen, "listen", ":8080", "listen for HTTP requests on this address.")
+	fs.IntVar(&maxSearches, "max-searches", 4, "the maximum number of searches that run at the same time.  Other requests wait for a search to finish.")
+	fs.IntVar(&maxResponses, "max-responses", 1000, "the maximum number of cached responses.  The oldest response is removed to cache another.")
+	fs.DurationVar(&ttl, "response-ttl", 5*time.Minute, "cache responses for this long.  Use 0 to turn off the response cache.  Use --cache to cache quake details.")
+	fs.Usage = usage(fs, "serve [flags]", commands["serve"].about)
+
+	if a := parseFlags(fs, args); len(a) > 0 {
+		log.Fatalf("unexpected arguments for serve: %v", a)
+	}
+
+	if maxSearches < 1 {
+		log.Fatal("--max-searches must be at least 1.")
+	}
+
+	if maxResponses < 1 {
+		log.Fatal("--max-responses must be at least 1.")
+	}
+
+	// Searches run at the same time so their progress is logged rather than drawn.
+	progressBar = false
+
+	sv := &server{
+		searches:     make(chan struct{}, maxSearches),
+		ttl:          ttl,
+		maxResponses: maxResponses,
+		search:       searchQuakes,
+		cache:        make(map[string]response),
+	}
+
+	mux := http.NewServeMux()
+	for n := range endpoints {
+		mux.HandleFunc("/"+n, sv.handler(n))
+	}
+	mux.HandleFunc("/fdsnws/event/1/query", sv.fdsnQuery)
+	mux.HandleFunc("/fdsnws/event/1/version", fdsnVersionHandler)
+	mux.HandleFunc("/fdsnws/event/1/application.wadl", fdsnWADL)
+
+	s := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	infof("Listening on %s", listen)
+	log.Fatal(s.ListenAndServe())
+}
+
+// handler returns the handler for the endpoint name.  The query parameters are the same as the command
+// line flags for the command name.  The output parameter selects csv (the default), json, or, for
+// events only, geojson.
+func (sv *server) handler(name string) http.HandlerFunc {
+	ep := endpoints[name]
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		start := time.Now()
+
+		params := r.URL.Query()
+		key := name + "?" + params.Encode()
+
+		if c, ok := sv.cached(key); ok {
+			w.Header().Set("Content-Type", c.contentType)
+			w.Write(c.body)
+			return
+		}
+
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+
+		var s search
+		var o outputs
+
+		f := ep.selected(&o)
+
+		s.addFlags(fs)
+		fs.StringVar(f, "format", ep.defaultFormat, "")
+		fs.BoolVar(&o.header, "header", false, "")
+		if ep.filters {
+			o.addFilterFlags(fs)
+		}
+		o.addSortFlags(fs)
+
+		out := "csv"
+
+		for k, v := range params {
+			switch {
+			case k == "output":
+				out = v[len(v)-1]
+				continue
+			// Reading files on the server is not allowed.
+			case k == "eventid-file" || fs.Lookup(k) == nil:
+				http.Error(w, "unknown parameter "+k, http.StatusBadRequest)
+				return
+			}
+			if err := fs.Set(k, strings.Join(v, ",")); err != nil {
+				http.Error(w, fmt.Sprintf("invalid value for %s: %v", k, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if out != "csv" && out != "json" && !(out == "geojson" && name == "events") {
+			http.Error(w, "invalid output "+out, http.StatusBadRequest)
+			return
+		}
+
+		query, err := s.query(fs, true)
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		if err = o.check(); err != nil {
+			badRequest(w, err)
+			return
+		}
+
+		maxDetails := 0
+		if out == "geojson" {
+			maxDetails = math.MaxInt32
+		}
+
+		res, ok, err := sv.find(r, query, &o, maxDetails)
+		switch {
+		case !ok:
+			return
+		case err != nil:
+			log.Printf("%s: %v", r.URL, err)
+			http.Error(w, "error searching for quakes", http.StatusBadGateway)
+			return
+		}
+
+		var b bytes.Buffer
+		c := response{expires: time.Now().Add(sv.ttl)}
+
+		rows := o.arrange(*f, ep.rows(res), ep.format)
+
+		switch out {
+		case "csv":
+			c.contentType = "text/csv; charset=utf-8"
+			err = writeCSV(&b, strings.Split(*f, ","), rows, o.header)
+		case "json":
+			c.contentType = "application/json"
+			err = writeJSON(&b, strings.Split(*f, ","), rows)
+		case "geojson":
+			c.contentType = "application/geo+json"
+			err = writeGeoJSON(&b, res.props, res.details)
+		}
+
+		if err != nil {
+			log.Printf("%s: %v", r.URL, err)
+			http.Error(w, "error writing the response", http.StatusInternalServerError)
+			return
+		}
+
+		c.body = b.Bytes()
+		sv.store(key, c)
+
+		w.Header().Set("Content-Type", c.contentType)
+		w.Write(c.body)
+
+		infof("%s %d rows in %s", r.URL, len(rows), time.Since(start))
+	}
+}
+
+// find searches for quakes and their details when fewer than the maximum number of searches are
+// running.  The details are fetched for the outputs in o and, if there are no more than maxDetails
+// quakes, for all the quakes.  ok is false if the request is cancelled while waiting.
+func (sv *server) find(r *http.Request, query wfs.Query, o *outputs, maxDetails int) (res results, ok bool, err error) {
+	select {
+	case sv.searches <- struct{}{}:
+	case <-r.Context().Done():
+		return res, false, nil
+	}
+
+	defer func() { <-sv.searches }()
+
+	infof("Searching for quakes")
+
+	props, err := sv.search(query)
+	if err != nil {
+		return res, true, err
+	}
+
+	return findDetails(props, o, maxDetails > 0 && len(props) <= maxDetails), true, nil
+}
+
+// badRequest writes err as a bad request response.  The errors name command line flags, which are
+// query parameters for the HTTP API.
+func badRequest(w http.ResponseWriter, err error) {
+	http.Error(w, strings.Replace(err.Error(), "--", "", -1), http.StatusBadRequest)
+}
+
+// cached returns the cached response for key if it has not expired.
+func (sv *server) cached(key string) (c response, ok bool) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	c, ok = sv.cache[key]
+	if ok && time.Now().After(c.expires) {
+		delete(sv.cache, key)
+		return c, false
+	}
+
+	return c, ok
+}
+
+// store caches c for key and removes expired responses.  If there are maxResponses responses the one
+// that expires first, which is the oldest, is removed.
+func (sv *server) store(key string, c response) {
+	if sv.ttl <= 0 || sv.maxResponses <= 0 {
+		return
+	}
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range sv.cache {
+		if now.After(v.expires) {
+			delete(sv.cache, k)
+		}
+	}
+
+	delete(sv.cache, key)
+
+	for len(sv.cache) >= sv.maxResponses {
+		var oldest string
+		for k, v := range sv.cache {
+			if oldest == "" || v.expires.Before(sv.cache[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(sv.cache, oldest)
+	}
+
+	sv.cache[key] = c
+}
+
+// writeJSON writes the values for the columns oF from each row to w as a JSON array of objects.
+func writeJSON(w io.Writer, oF []string, rows []map[string]string) error {
+	j := make([]map[string]string, len(rows))
+
+	for i, v := range rows {
+		j[i] = make(map[string]string, len(oF))
+		for _, n := range oF {
+			j[i][n] = v[n]
+		}
+	}
+
+	return json.NewEncoder(w).Encode(j)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/GeoNet/qsearch/wfs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer returns a server that finds the quakes props instead of searching the WFS.  The queries
+// that are searched for are added to queries.
+func testServer(props []wfs.Properties, err error, queries *[]wfs.Query) *server {
+	return &server{
+		searches:     make(chan struct{}, 1),
+		ttl:          time.Minute,
+		maxResponses: 10,
+		search: func(q wfs.Query) ([]wfs.Properties, error) {
+			*queries = append(*queries, q)
+			return props, err
+		},
+		cache: make(map[string]response),
+	}
+}
+
+// get returns the response from h for the request target.
+func get(h http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestServeEvents(t *testing.T) {
+	var queries []wfs.Query
+
+	props := []wfs.Properties{{PublicID: "a", Magnitude: 3.1}, {PublicID: "b", Magnitude: 4.5}}
+
+	h := testServer(props, nil, &queries).handler("events")
+
+	target := "/events?start=2014-01-01T00:00:00Z&end=2014-01-02T00:00:00Z&min-magnitude=3&bbox=174,-41,175,-42" +
+		"&format=EventID,Magnitude&sort-by=-Magnitude&header=true"
+
+	w := get(h, "GET", target)
+
+	if w.Code != http.StatusOK {
+		t.Fatal("expected 200, got ", w.Code, w.Body.String())
+	}
+
+	if c := w.Header().Get("Content-Type"); c != "text/csv; charset=utf-8" {
+		t.Error("Content-Type expected text/csv, got ", c)
+	}
+
+	if w.Body.String() != "EventID,Magnitude\nb,4.5\na,3.1\n" {
+		t.Error("incorrect csv, got ", w.Body.String())
+	}
+
+	if len(queries) != 1 {
+		t.Fatal("expected 1 search, got ", len(queries))
+	}
+
+	q := queries[0]
+
+	if s := q.Start.Format(time.RFC3339); s != "2014-01-01T00:00:00Z" {
+		t.Error("Start expected 2014-01-01T00:00:00Z, got ", s)
+	}
+
+	if q.MinMagnitude != 3 {
+		t.Error("MinMagnitude expected 3, got ", q.MinMagnitude)
+	}
+
+	if q.Bbox != "174,-41,175,-42" {
+		t.Error("Bbox expected 174,-41,175,-42, got ", q.Bbox)
+	}
+
+	// The same request is served from the response cache.
+	if w = get(h, "GET", target); w.Code != http.StatusOK || w.Body.String() != "EventID,Magnitude\nb,4.5\na,3.1\n" {
+		t.Error("incorrect cached response, got ", w.Code, w.Body.String())
+	}
+
+	if len(queries) != 1 {
+		t.Error("expected the response to be cached, got searches ", len(queries))
+	}
+
+	w = get(h, "GET", "/events?eventid=a,b&format=EventID,Magnitude&output=json")
+
+	if c := w.Header().Get("Content-Type"); c != "application/json" {
+		t.Error("Content-Type expected application/json, got ", c)
+	}
+
+	var j []map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &j); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(j) != 2 || j[0]["EventID"] != "a" || j[1]["Magnitude"] != "4.5" {
+		t.Error("incorrect json, got ", w.Body.String())
+	}
+
+	if q = queries[len(queries)-1]; len(q.EventIDs) != 2 || q.EventIDs[1] != "b" {
+		t.Error("EventIDs expected [a b], got ", q.EventIDs)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	var queries []wfs.Query
+
+	h := testServer(nil, nil, &queries).handler("events")
+
+	for _, v := range []struct {
+		method, target string
+		code           int
+	}{
+		{"POST", "/events?eventid=a", http.StatusMethodNotAllowed},
+		// Reading files on the server is not allowed.
+		{"GET", "/events?eventid-file=/etc/passwd", http.StatusBadRequest},
+		{"GET", "/events?eventid=a&cache=/tmp", http.StatusBadRequest},
+		{"GET", "/events?eventid=a&min-magnitude=big", http.StatusBadRequest},
+		{"GET", "/events?eventid=a&output=xml", http.StatusBadRequest},
+		{"GET", "/events?eventid=a&start=2014-01-01T00:00:00Z", http.StatusBadRequest},
+		{"GET", "/events?eventid=a&format=EventID,Nope", http.StatusBadRequest},
+		{"GET", "/events?eventid=a&sort-by=Nope", http.StatusBadRequest},
+		{"GET", "/events", http.StatusBadRequest},
+	} {
+		if w := get(h, v.method, v.target); w.Code != v.code {
+			t.Errorf("%s %s expected %d, got %d %s", v.method, v.target, v.code, w.Code, w.Body.String())
+		}
+	}
+
+	if len(queries) != 0 {
+		t.Error("expected no searches for bad requests, got ", len(queries))
+	}
+
+	// geojson is only for events.
+	if w := get(testServer(nil, nil, &queries).handler("picks"), "GET", "/picks?eventid=a&output=geojson"); w.Code != http.StatusBadRequest {
+		t.Error("expected 400 for geojson picks, got ", w.Code)
+	}
+
+	h = testServer(nil, errors.New("WFS error"), &queries).handler("events")
+
+	if w := get(h, "GET", "/events?eventid=a&format=EventID"); w.Code != http.StatusBadGateway {
+		t.Error("expected 502 for a search error, got ", w.Code)
+	}
+}
+
+func TestServePicks(t *testing.T) {
+	defer testCache(t, "2012p070732-sc3")()
+
+	var queries []wfs.Query
+
+	p := wfs.Properties{PublicID: "2012p070732-sc3", ModificationTime: "2012-01-27T04:30:00Z"}
+
+	h := testServer([]wfs.Properties{p}, nil, &queries).handler("picks")
+
+	w := get(h, "GET", "/picks?start=2012-01-27T04:00:00Z&end=2012-01-27T05:00:00Z&format=EventID,StationCode&sort-by=StationCode")
+
+	if w.Code != http.StatusOK {
+		t.Fatal("expected 200, got ", w.Code, w.Body.String())
+	}
+
+	l := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+
+	if len(l) != 10 {
+		t.Fatal("expected 10 picks, got ", len(l))
+	}
+
+	if !strings.HasPrefix(l[0], "2012p070732-sc3,") || l[0] > l[9] {
+		t.Error("expected picks sorted by station, got ", l)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	sv := &server{ttl: time.Minute, maxResponses: 10, cache: make(map[string]response)}
+
+	sv.store("a", response{body: []byte("a"), expires: time.Now().Add(time.Minute)})
+	sv.store("b", response{body: []byte("b"), expires: time.Now().Add(-time.Second)})
+
+	if c, ok := sv.cached("a"); !ok || string(c.body) != "a" {
+		t.Error("expected a cached response for a")
+	}
+
+	if _, ok := sv.cached("b"); ok {
+		t.Error("expected no cached response for b as it has expired")
+	}
+
+	// Storing removes expired responses.
+	sv.cache["c"] = response{expires: time.Now().Add(-time.Second)}
+	sv.store("d", response{expires: time.Now().Add(time.Minute)})
+
+	if _, ok := sv.cache["c"]; ok {
+		t.Error("expected the expired response for c to be removed")
+	}
+
+	sv = &server{maxResponses: 10, cache: make(map[string]response)}
+	sv.store("a", response{expires: time.Now().Add(time.Minute)})
+
+	if _, ok := sv.cached("a"); ok {
+		t.Error("expected no response cache with a ttl of 0")
+	}
+
+	// The oldest response is removed when the cache is full.
+	sv = &server{ttl: time.Minute, maxResponses: 2, cache: make(map[string]response)}
+
+	now := time.Now()
+	sv.store("a", response{expires: now.Add(time.Minute)})
+	sv.store("b", response{expires: now.Add(2 * time.Minute)})
+	sv.store("c", response{expires: now.Add(3 * time.Minute)})
+
+	if len(sv.cache) != 2 {
+		t.Error("expected 2 cached responses, got ", len(sv.cache))
+	}
+
+	if _, ok := sv.cached("a"); ok {
+		t.Error("expected the oldest response, a, to be removed")
+	}
+
+	for _, k := range []string{"b", "c"} {
+		if _, ok := sv.cached(k); !ok {
+			t.Error("expected a cached response for ", k)
+		}
+	}
+
+	// Storing a response again replaces it rather than removing another.
+	sv.store("c", response{expires: now.Add(4 * time.Minute)})
+
+	if _, ok := sv.cached("b"); !ok || len(sv.cache) != 2 {
+		t.Error("expected b to be kept when c is stored again")
+	}
+}
+
+func TestServeFind(t *testing.T) {
+	defer testCache(t, "2012p070732-sc3")()
+
+	var queries []wfs.Query
+
+	p := []wfs.Properties{{PublicID: "2012p070732-sc3", ModificationTime: "2012-01-27T04:30:00Z"}}
+
+	sv := testServer(p, nil, &queries)
+	r := httptest.NewRequest("GET", "/fdsnws/event/1/query", nil)
+
+	for _, v := range []struct {
+		maxDetails, details int
+	}{
+		// No details with a maxDetails of 0.
+		{0, 0},
+		{1, 1},
+		{2, 1},
+	} {
+		res, ok, err := sv.find(r, wfs.Query{}, &outputs{}, v.maxDetails)
+		if !ok || err != nil {
+			t.Fatal("expected to find quakes, got ", ok, err)
+		}
+
+		if len(res.details) != v.details {
+			t.Errorf("maxDetails %d expected details for %d quakes, got %d", v.maxDetails, v.details, len(res.details))
+		}
+	}
+
+	p = append(p, wfs.Properties{PublicID: "2014p549333"})
+	sv = testServer(p, nil, &queries)
+
+	if res, _, _ := sv.find(r, wfs.Query{}, &outputs{}, 1); len(res.details) != 0 {
+		t.Error("expected no details for more quakes than maxDetails, got ", len(res.details))
+	}
+}
+
+func TestFDSNQueryText(t *testing.T) {
+	var queries []wfs.Query
+
+	p := []wfs.Properties{{PublicID: "2014p549333", OriginTime: "2014-07-23T06:04:43.625Z", MagnitudeType: "ML", Magnitude: 2.64}}
+
+	w := get(testServer(p, nil, &queries).fdsnQuery, "GET", "/fdsnws/event/1/query?starttime=2014-07-23&endtime=2014-07-24&format=text")
+
+	if w.Code != http.StatusOK {
+		t.Fatal("expected 200, got ", w.Code, w.Body.String())
+	}
+
+	l := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+
+	if len(l) != 2 || !strings.HasPrefix(l[1], "2014p549333|2014-07-23T06:04:43.625Z|") {
+		t.Error("incorrect text response, got ", w.Body.String())
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortKey is a column to sort the output by.
+type sortKey struct {
+	name string
+	desc bool
+}
+
+// sortKeys returns the keys in the ',' separated list s.  A leading '-' sorts the column in
+// descending order e.g., OriginTime,-Magnitude.
+func sortKeys(s string) (k []sortKey) {
+	if s == "" {
+		return nil
+	}
+
+	for _, n := range strings.Split(s, ",") {
+		n = strings.TrimSpace(n)
+		desc := strings.HasPrefix(n, "-")
+		k = append(k, sortKey{name: strings.TrimPrefix(n, "-"), desc: desc})
+	}
+
+	return k
+}
+
+// checkSort checks that each key in the ',' separated list s is in at least one of the formats.
+func checkSort(s string, formats ...map[string]string) error {
+keys:
+	for _, k := range sortKeys(s) {
+		for _, f := range formats {
+			if _, ok := f[k.name]; ok {
+				continue keys
+			}
+		}
+		return errors.New("Invalid --sort-by key: " + k.name + ".  It must be in the format for a selected output.")
+	}
+
+	return nil
+}
+
+// arrange returns rows sorted by the --sort-by keys that are in format.  If --unique is set rows
+// with the same values for the columns in the ',' separated format f are removed.  Rows that
+// compare equal keep their order.
+func (o *outputs) arrange(f string, rows []map[string]string, format map[string]string) []map[string]string {
+	var keys []sortKey
+	for _, k := range sortKeys(o.sortBy) {
+		if _, ok := format[k.name]; ok {
+			keys = append(keys, k)
+		}
+	}
+
+	if len(keys) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, k := range keys {
+				c := compareValues(rows[i][k.name], rows[j][k.name], k.desc)
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	if o.unique && f != "" {
+		rows = uniqueRows(strings.Split(f, ","), rows)
+	}
+
+	return rows
+}
+
+// compareValues returns -1, 0, or 1 for the order of a and b.  Values are compared as numbers if they
+// both are numbers, as times if they are both RFC3339 times, and otherwise as strings.  If desc is true
+// the order is reversed.  Empty values are always last.
+func compareValues(a, b string, desc bool) (c int) {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	x, errx := strconv.ParseFloat(a, 64)
+	y, erry := strconv.ParseFloat(b, 64)
+	tx, errtx := time.Parse(time.RFC3339Nano, a)
+	ty, errty := time.Parse(time.RFC3339Nano, b)
+
+	switch {
+	case errx == nil && erry == nil:
+		c = compareFloat(x, y)
+	case errtx == nil && errty == nil:
+		c = tx.Compare(ty)
+	default:
+		c = strings.Compare(a, b)
+	}
+
+	if desc {
+		c = -c
+	}
+
+	return c
+}
+
+// compareFloat returns -1, 0, or 1 for the order of x and y.
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// uniqueRows returns the rows that have different values for the columns oF from all earlier rows.
+func uniqueRows(oF []string, rows []map[string]string) (u []map[string]string) {
+	seen := make(map[string]bool)
+
+	for _, v := range rows {
+		s := make([]string, len(oF))
+		for i, n := range oF {
+			s[i] = v[n]
+		}
+
+		// The unit separator doesn't appear in the values.
+		k := strings.Join(s, "\x1f")
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		u = append(u, v)
+	}
+
+	return u
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareValues(t *testing.T) {
+	for _, v := range []struct {
+		a, b string
+		desc bool
+		c    int
+	}{
+		{"2.5", "10", false, -1},
+		{"10", "2.5", false, 1},
+		{"-1.5", "-1.50", false, 0},
+		{"2.5", "10", true, 1},
+		{"M", "ML", false, -1},
+		{"ML", "Mw", false, -1},
+		// Numbers and strings are compared as strings.
+		{"10", "M", false, -1},
+		// Times with different precision and zones are compared as times.
+		{"2014-07-23T06:04:43.625Z", "2014-07-23T06:04:43Z", false, 1},
+		{"2014-07-23T18:04:43+12:00", "2014-07-23T06:04:44Z", false, -1},
+		{"2014-07-23T06:04:43.625Z", "2014-07-23T06:04:43Z", true, -1},
+		// Empty values are last in either order.
+		{"", "1", false, 1},
+		{"1", "", false, -1},
+		{"", "1", true, 1},
+		{"1", "", true, -1},
+		{"", "", true, 0},
+	} {
+		if c := compareValues(v.a, v.b, v.desc); c != v.c {
+			t.Errorf("compareValues(%q, %q, %t) expected %d, got %d", v.a, v.b, v.desc, v.c, c)
+		}
+	}
+}
+
+func TestArrange(t *testing.T) {
+	format := map[string]string{"EventID": "", "Magnitude": "", "OriginTime": "", "StationCode": ""}
+
+	rows := func() []map[string]string {
+		return []map[string]string{
+			{"EventID": "a", "Magnitude": "2.5", "OriginTime": "2014-07-23T06:04:43Z", "StationCode": "WEL"},
+			{"EventID": "b", "Magnitude": "10", "OriginTime": "2014-07-23T06:04:43.625Z", "StationCode": "WEL"},
+			{"EventID": "c", "Magnitude": "", "OriginTime": "2014-07-23T06:04:42Z", "StationCode": "SNZO"},
+			{"EventID": "d", "Magnitude": "2.5", "OriginTime": "2014-07-23T06:04:41Z", "StationCode": "WEL"},
+		}
+	}
+
+	for _, v := range []struct {
+		sortBy, f string
+		unique    bool
+		order     string
+	}{
+		{"", "", false, "abcd"},
+		// Rows that compare equal keep their order.
+		{"Magnitude", "", false, "adbc"},
+		{"-Magnitude", "", false, "badc"},
+		{"Magnitude,-OriginTime", "", false, "adbc"},
+		{"Magnitude,OriginTime", "", false, "dabc"},
+		{"OriginTime", "", false, "dcab"},
+		// Keys that are not in the format are ignored.
+		{"Depth,-OriginTime", "", false, "bacd"},
+		{"StationCode", "", false, "cabd"},
+		{"", "StationCode", true, "ac"},
+		{"-Magnitude", "Magnitude,StationCode", true, "bac"},
+	} {
+		o := outputs{sortBy: v.sortBy, unique: v.unique}
+
+		var order []string
+		for _, r := range o.arrange(v.f, rows(), format) {
+			order = append(order, r["EventID"])
+		}
+
+		if s := strings.Join(order, ""); s != v.order {
+			t.Errorf("--sort-by %s --unique %t expected %s, got %s", v.sortBy, v.unique, v.order, s)
+		}
+	}
+}
+
+func TestCheckSort(t *testing.T) {
+	f := map[string]string{"Magnitude": ""}
+
+	if err := checkSort("-Magnitude", f); err != nil {
+		t.Error(err)
+	}
+
+	if err := checkSort("Magnitude,Depth", f); err == nil {
+		t.Error("expected an error for a key that is not in a format")
+	}
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// schema is the SQLite schema for --sqlite.  Origins, magnitudes, station magnitudes, amplitudes, focal mechanisms, and
+// picks belong to an event.  Arrivals link an origin to a pick, station magnitude contributions link a magnitude to a
+// station magnitude, and moment tensors belong to a focal mechanism.  Deleting an event deletes everything that belongs
+// to it.  Event changes are the changes found by sync and are kept when an event is deleted.
+const schema = `
+CREATE TABLE IF NOT EXISTS event (
+	publicid TEXT PRIMARY KEY,
+	event_type TEXT,
+	origin_time TEXT,
+	modification_time TEXT,
+	latitude REAL,
+	longitude REAL,
+	depth REAL,
+	magnitude REAL,
+	evaluation_method TEXT,
+	evaluation_status TEXT,
+	evaluation_mode TEXT,
+	earth_model TEXT,
+	depth_type TEXT,
+	origin_error REAL,
+	used_phase_count INTEGER,
+	used_station_count INTEGER,
+	minimum_distance REAL,
+	azimuthal_gap REAL,
+	magnitude_type TEXT,
+	magnitude_uncertainty REAL,
+	magnitude_station_count INTEGER,
+	preferred_origin_id TEXT,
+	preferred_magnitude_id TEXT,
+	preferred_focal_mechanism_id TEXT,
+	event_type_certainty TEXT,
+	description TEXT,
+	comment TEXT
+);
+
+CREATE TABLE IF NOT EXISTS origin (
+	publicid TEXT PRIMARY KEY,
+	event_id TEXT NOT NULL REFERENCES event(publicid) ON DELETE CASCADE,
+	time TEXT,
+	latitude REAL,
+	latitude_uncertainty REAL,
+	longitude REAL,
+	longitude_uncertainty REAL,
+	depth REAL,
+	depth_uncertainty REAL,
+	associated_phase_count INTEGER,
+	used_phase_count INTEGER,
+	associated_station_count INTEGER,
+	used_station_count INTEGER,
+	standard_error REAL,
+	azimuthal_gap REAL,
+	secondary_azimuthal_gap REAL,
+	ground_truth_level TEXT,
+	minimum_distance REAL,
+	median_distance REAL,
+	maximum_distance REAL,
+	method_id TEXT,
+	earth_model_id TEXT,
+	evaluation_mode TEXT,
+	evaluation_status TEXT,
+	horizontal_uncertainty REAL,
+	min_horizontal_uncertainty REAL,
+	max_horizontal_uncertainty REAL,
+	azimuth_max_horizontal_uncertainty REAL,
+	semi_major_axis_length REAL,
+	semi_minor_axis_length REAL,
+	semi_intermediate_axis_length REAL,
+	major_axis_plunge REAL,
+	major_axis_azimuth REAL,
+	major_axis_rotation REAL,
+	confidence_level REAL,
+	preferred_description TEXT,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS magnitude (
+	publicid TEXT PRIMARY KEY,
+	event_id TEXT NOT NULL REFERENCES event(publicid) ON DELETE CASCADE,
+	origin_id TEXT REFERENCES origin(publicid) ON DELETE CASCADE,
+	type TEXT,
+	value REAL,
+	uncertainty REAL,
+	method_id TEXT,
+	station_count INTEGER,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS station_magnitude (
+	publicid TEXT PRIMARY KEY,
+	event_id TEXT NOT NULL REFERENCES event(publicid) ON DELETE CASCADE,
+	origin_id TEXT REFERENCES origin(publicid) ON DELETE CASCADE,
+	type TEXT,
+	value REAL,
+	amplitude_id TEXT,
+	method_id TEXT,
+	network_code TEXT,
+	station_code TEXT,
+	location_code TEXT,
+	channel_code TEXT,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS station_magnitude_contribution (
+	magnitude_id TEXT NOT NULL REFERENCES magnitude(publicid) ON DELETE CASCADE,
+	station_magnitude_id TEXT NOT NULL REFERENCES station_magnitude(publicid) ON DELETE CASCADE,
+	residual REAL,
+	weight REAL,
+	PRIMARY KEY (magnitude_id, station_magnitude_id)
+);
+
+CREATE TABLE IF NOT EXISTS focal_mechanism (
+	publicid TEXT PRIMARY KEY,
+	event_id TEXT NOT NULL REFERENCES event(publicid) ON DELETE CASCADE,
+	triggering_origin_id TEXT,
+	strike1 REAL,
+	dip1 REAL,
+	rake1 REAL,
+	strike2 REAL,
+	dip2 REAL,
+	rake2 REAL,
+	preferred_plane INTEGER,
+	t_axis_azimuth REAL,
+	t_axis_plunge REAL,
+	t_axis_length REAL,
+	p_axis_azimuth REAL,
+	p_axis_plunge REAL,
+	p_axis_length REAL,
+	n_axis_azimuth REAL,
+	n_axis_plunge REAL,
+	n_axis_length REAL,
+	azimuthal_gap REAL,
+	station_polarity_count INTEGER,
+	misfit REAL,
+	method_id TEXT,
+	evaluation_mode TEXT,
+	evaluation_status TEXT,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS moment_tensor (
+	publicid TEXT PRIMARY KEY,
+	focal_mechanism_id TEXT NOT NULL REFERENCES focal_mechanism(publicid) ON DELETE CASCADE,
+	derived_origin_id TEXT,
+	moment_magnitude_id TEXT,
+	scalar_moment REAL,
+	mrr REAL,
+	mtt REAL,
+	mpp REAL,
+	mrt REAL,
+	mrp REAL,
+	mtp REAL,
+	variance_reduction REAL,
+	double_couple REAL,
+	clvd REAL,
+	method_id TEXT,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS pick (
+	publicid TEXT PRIMARY KEY,
+	event_id TEXT NOT NULL REFERENCES event(publicid) ON DELETE CASCADE,
+	time TEXT,
+	network_code TEXT,
+	station_code TEXT,
+	location_code TEXT,
+	channel_code TEXT,
+	phase_hint TEXT,
+	evaluation_mode TEXT,
+	evaluation_status TEXT,
+	time_uncertainty REAL,
+	time_lower_uncertainty REAL,
+	time_upper_uncertainty REAL,
+	method_id TEXT,
+	polarity TEXT,
+	onset TEXT,
+	backazimuth REAL,
+	backazimuth_uncertainty REAL,
+	horizontal_slowness REAL,
+	horizontal_slowness_uncertainty REAL,
+	slowness_method_id TEXT,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS amplitude (
+	publicid TEXT PRIMARY KEY,
+	event_id TEXT NOT NULL REFERENCES event(publicid) ON DELETE CASCADE,
+	pick_id TEXT REFERENCES pick(publicid) ON DELETE SET NULL,
+	type TEXT,
+	value REAL,
+	uncertainty REAL,
+	unit TEXT,
+	period REAL,
+	snr REAL,
+	time_window_reference TEXT,
+	time_window_begin REAL,
+	time_window_end REAL,
+	method_id TEXT,
+	magnitude_hint TEXT,
+	network_code TEXT,
+	station_code TEXT,
+	location_code TEXT,
+	channel_code TEXT,
+	agency_id TEXT,
+	author TEXT,
+	creation_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS arrival (
+	origin_id TEXT NOT NULL REFERENCES origin(publicid) ON DELETE CASCADE,
+	pick_id TEXT NOT NULL REFERENCES pick(publicid) ON DELETE CASCADE,
+	phase TEXT,
+	azimuth REAL,
+	distance REAL,
+	time_residual REAL,
+	time_weight REAL,
+	time_correction REAL,
+	takeoff_angle REAL,
+	horizontal_slowness_residual REAL,
+	backazimuth_residual REAL,
+	horizontal_slowness_weight REAL,
+	backazimuth_weight REAL,
+	earth_model_id TEXT,
+	PRIMARY KEY (origin_id, pick_id)
+);
+
+CREATE TABLE IF NOT EXISTS event_change (
+	sync_time TEXT NOT NULL,
+	event_id TEXT NOT NULL,
+	change TEXT NOT NULL,
+	event_type TEXT,
+	previous_event_type TEXT,
+	modification_time TEXT
+);
+
+CREATE TABLE IF NOT EXISTS event_document (
+	event_id TEXT PRIMARY KEY REFERENCES event(publicid) ON DELETE CASCADE,
+	document TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS event_origin_time ON event(origin_time);
+CREATE INDEX IF NOT EXISTS event_magnitude ON event(magnitude);
+CREATE INDEX IF NOT EXISTS origin_event_id ON origin(event_id);
+CREATE INDEX IF NOT EXISTS magnitude_event_id ON magnitude(event_id);
+CREATE INDEX IF NOT EXISTS station_magnitude_event_id ON station_magnitude(event_id);
+CREATE INDEX IF NOT EXISTS station_magnitude_contribution_station_magnitude_id ON station_magnitude_contribution(station_magnitude_id);
+CREATE INDEX IF NOT EXISTS amplitude_event_id ON amplitude(event_id);
+CREATE INDEX IF NOT EXISTS focal_mechanism_event_id ON focal_mechanism(event_id);
+CREATE INDEX IF NOT EXISTS moment_tensor_focal_mechanism_id ON moment_tensor(focal_mechanism_id);
+CREATE INDEX IF NOT EXISTS pick_event_id ON pick(event_id);
+CREATE INDEX IF NOT EXISTS pick_station ON pick(network_code, station_code);
+CREATE INDEX IF NOT EXISTS arrival_pick_id ON arrival(pick_id);
+CREATE INDEX IF NOT EXISTS event_change_event_id ON event_change(event_id);
+`
+
+// columns lists columns that have been added to the schema.  They are added to tables in databases
+// created before they were in the schema.
+var columns = []struct {
+	table, name, decl string
+}{
+	{"event", "preferred_focal_mechanism_id", "TEXT"},
+	{"origin", "latitude", "REAL"},
+	{"origin", "latitude_uncertainty", "REAL"},
+	{"origin", "longitude", "REAL"},
+	{"origin", "longitude_uncertainty", "REAL"},
+	{"origin", "depth", "REAL"},
+	{"origin", "depth_uncertainty", "REAL"},
+	{"origin", "associated_phase_count", "INTEGER"},
+	{"origin", "used_phase_count", "INTEGER"},
+	{"origin", "associated_station_count", "INTEGER"},
+	{"origin", "used_station_count", "INTEGER"},
+	{"origin", "standard_error", "REAL"},
+	{"origin", "azimuthal_gap", "REAL"},
+	{"origin", "secondary_azimuthal_gap", "REAL"},
+	{"origin", "ground_truth_level", "TEXT"},
+	{"origin", "minimum_distance", "REAL"},
+	{"origin", "median_distance", "REAL"},
+	{"origin", "maximum_distance", "REAL"},
+	{"origin", "method_id", "TEXT"},
+	{"origin", "earth_model_id", "TEXT"},
+	{"origin", "evaluation_mode", "TEXT"},
+	{"origin", "evaluation_status", "TEXT"},
+	{"event", "event_type_certainty", "TEXT"},
+	{"event", "description", "TEXT"},
+	{"event", "comment", "TEXT"},
+	{"origin", "horizontal_uncertainty", "REAL"},
+	{"origin", "min_horizontal_uncertainty", "REAL"},
+	{"origin", "max_horizontal_uncertainty", "REAL"},
+	{"origin", "azimuth_max_horizontal_uncertainty", "REAL"},
+	{"origin", "semi_major_axis_length", "REAL"},
+	{"origin", "semi_minor_axis_length", "REAL"},
+	{"origin", "semi_intermediate_axis_length", "REAL"},
+	{"origin", "major_axis_plunge", "REAL"},
+	{"origin", "major_axis_azimuth", "REAL"},
+	{"origin", "major_axis_rotation", "REAL"},
+	{"origin", "confidence_level", "REAL"},
+	{"origin", "preferred_description", "TEXT"},
+	{"pick", "time_uncertainty", "REAL"},
+	{"pick", "time_lower_uncertainty", "REAL"},
+	{"pick", "time_upper_uncertainty", "REAL"},
+	{"pick", "method_id", "TEXT"},
+	{"pick", "polarity", "TEXT"},
+	{"pick", "onset", "TEXT"},
+	{"pick", "backazimuth", "REAL"},
+	{"pick", "backazimuth_uncertainty", "REAL"},
+	{"pick", "horizontal_slowness", "REAL"},
+	{"pick", "horizontal_slowness_uncertainty", "REAL"},
+	{"pick", "slowness_method_id", "TEXT"},
+	{"pick", "agency_id", "TEXT"},
+	{"pick", "author", "TEXT"},
+	{"pick", "creation_time", "TEXT"},
+	{"amplitude", "agency_id", "TEXT"},
+	{"amplitude", "author", "TEXT"},
+	{"amplitude", "creation_time", "TEXT"},
+	{"origin", "agency_id", "TEXT"},
+	{"origin", "author", "TEXT"},
+	{"origin", "creation_time", "TEXT"},
+	{"magnitude", "agency_id", "TEXT"},
+	{"magnitude", "author", "TEXT"},
+	{"magnitude", "creation_time", "TEXT"},
+	{"station_magnitude", "agency_id", "TEXT"},
+	{"station_magnitude", "author", "TEXT"},
+	{"station_magnitude", "creation_time", "TEXT"},
+	{"focal_mechanism", "agency_id", "TEXT"},
+	{"focal_mechanism", "author", "TEXT"},
+	{"focal_mechanism", "creation_time", "TEXT"},
+	{"moment_tensor", "agency_id", "TEXT"},
+	{"moment_tensor", "author", "TEXT"},
+	{"moment_tensor", "creation_time", "TEXT"},
+	{"arrival", "time_correction", "REAL"},
+	{"arrival", "takeoff_angle", "REAL"},
+	{"arrival", "horizontal_slowness_residual", "REAL"},
+	{"arrival", "backazimuth_residual", "REAL"},
+	{"arrival", "horizontal_slowness_weight", "REAL"},
+	{"arrival", "backazimuth_weight", "REAL"},
+	{"arrival", "earth_model_id", "TEXT"},
+}
+
+const upsertEvent = `INSERT INTO event (publicid, event_type, origin_time, modification_time, latitude, longitude, depth, magnitude,
+	evaluation_method, evaluation_status, evaluation_mode, earth_model, depth_type, origin_error, used_phase_count,
+	used_station_count, minimum_distance, azimuthal_gap, magnitude_type, magnitude_uncertainty, magnitude_station_count)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(publicid) DO UPDATE SET event_type = excluded.event_type, origin_time = excluded.origin_time,
+	modification_time = excluded.modification_time, latitude = excluded.latitude, longitude = excluded.longitude,
+	depth = excluded.depth, magnitude = excluded.magnitude, evaluation_method = excluded.evaluation_method,
+	evaluation_status = excluded.evaluation_status, evaluation_mode = excluded.evaluation_mode,
+	earth_model = excluded.earth_model, depth_type = excluded.depth_type, origin_error = excluded.origin_error,
+	used_phase_count = excluded.used_phase_count, used_station_count = excluded.used_station_count,
+	minimum_distance = excluded.minimum_distance, azimuthal_gap = excluded.azimuthal_gap,
+	magnitude_type = excluded.magnitude_type, magnitude_uncertainty = excluded.magnitude_uncertainty,
+	magnitude_station_count = excluded.magnitude_station_count`
+
+// writeSQLite upserts the events from the WFS search into the SQLite database name, creating it if needed.
+// For events with details the origins, magnitudes, picks, and arrivals are replaced.  Events with no details
+// keep any that are already in the database.
+func writeSQLite(name string, quakes []map[string]string, qDetails map[string]seiscompml07.Event) (err error) {
+	db, err := sql.Open("sqlite3", name+"?_foreign_keys=1")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(schema); err != nil {
+		return err
+	}
+
+	if err = migrate(db); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range quakes {
+		if err = upsertQuake(tx, v, qDetails); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// upsertQuake upserts a single event and any details for it.
+func upsertQuake(tx *sql.Tx, v map[string]string, qDetails map[string]seiscompml07.Event) (err error) {
+	eid := v["EventID"]
+
+	_, err = tx.Exec(upsertEvent, eid, v["EventType"], v["OriginTime"], v["ModificationTime"],
+		null(v["Latitude"]), null(v["Longitude"]), null(v["Depth"]), null(v["Magnitude"]),
+		v["EvaluationMethod"], v["EvaluationStatus"], v["EvaluationMode"], v["EarthModel"], v["DepthType"],
+		null(v["OriginError"]), null(v["UsedPhaseCount"]), null(v["UsedStationCount"]),
+		null(v["MinimumDistance"]), null(v["AzimuthalGap"]), v["MagnitudeType"],
+		null(v["MagnitudeUncertainty"]), null(v["MagnitudeStationCount"]))
+	if err != nil {
+		return err
+	}
+
+	d, ok := qDetails[eid]
+	if !ok {
+		return nil
+	}
+
+	em := d.EventMap()
+
+	_, err = tx.Exec(`UPDATE event SET preferred_origin_id = ?, preferred_magnitude_id = ?, preferred_focal_mechanism_id = ?,
+		event_type_certainty = ?, description = ?, comment = ? WHERE publicid = ?`,
+		d.PreferredOriginID, d.PreferredMagnitudeID, null(d.PreferredFocalMechanismID),
+		null(em["EventTypeCertainty"]), null(em["Description"]), null(em["Comment"]), eid)
+	if err != nil {
+		return err
+	}
+
+	// Arrivals, magnitudes, contributions, and moment tensors cascade from these.
+	for _, t := range []string{"origin", "magnitude", "station_magnitude", "amplitude", "focal_mechanism", "pick"} {
+		if _, err = tx.Exec(`DELETE FROM `+t+` WHERE event_id = ?`, eid); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range d.P {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO pick (publicid, event_id, time, network_code, station_code, location_code,
+			channel_code, phase_hint, evaluation_mode, evaluation_status, time_uncertainty, time_lower_uncertainty,
+			time_upper_uncertainty, method_id, polarity, onset, backazimuth, backazimuth_uncertainty,
+			horizontal_slowness, horizontal_slowness_uncertainty, slowness_method_id, agency_id, author, creation_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.PublicID, eid, p.Time.Value.Format(time.RFC3339Nano), p.WaveformID.NetworkCode, p.WaveformID.StationCode,
+			p.WaveformID.LocationCode, p.WaveformID.ChannelCode, p.PhaseHint, p.EvaluationMode, p.EvaluationStatus,
+			p.Time.Uncertainty, p.Time.LowerUncertainty, p.Time.UpperUncertainty, p.MethodID, p.Polarity, p.Onset,
+			p.Backazimuth.Value, p.Backazimuth.Uncertainty, p.HorizontalSlowness.Value,
+			p.HorizontalSlowness.Uncertainty, p.SlownessMethodID,
+			p.CreationInfo.AgencyID, p.CreationInfo.Author, timeOrNull(p.CreationInfo.CreationTime))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range d.A {
+		var pid interface{}
+		if _, ok := d.Picks[a.PickID]; ok {
+			pid = a.PickID
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO amplitude (publicid, event_id, pick_id, type, value, uncertainty, unit,
+			period, snr, time_window_reference, time_window_begin, time_window_end, method_id, magnitude_hint, network_code,
+			station_code, location_code, channel_code, agency_id, author, creation_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.PublicID, eid, pid, a.Type, a.GenericAmplitude.Value, a.GenericAmplitude.Uncertainty, a.Unit,
+			a.Period.Value, a.SNR, a.TimeWindow.Reference.Format(time.RFC3339Nano), a.TimeWindow.Begin, a.TimeWindow.End,
+			a.MethodID, a.MagnitudeHint, a.WaveformID.NetworkCode, a.WaveformID.StationCode,
+			a.WaveformID.LocationCode, a.WaveformID.ChannelCode,
+			a.CreationInfo.AgencyID, a.CreationInfo.Author, timeOrNull(a.CreationInfo.CreationTime))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, o := range d.O {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO origin (publicid, event_id, time, latitude, latitude_uncertainty, longitude,
+			longitude_uncertainty, depth, depth_uncertainty, associated_phase_count, used_phase_count, associated_station_count,
+			used_station_count, standard_error, azimuthal_gap, secondary_azimuthal_gap, ground_truth_level, minimum_distance,
+			median_distance, maximum_distance, method_id, earth_model_id, evaluation_mode, evaluation_status,
+			horizontal_uncertainty, min_horizontal_uncertainty, max_horizontal_uncertainty, azimuth_max_horizontal_uncertainty,
+			semi_major_axis_length, semi_minor_axis_length, semi_intermediate_axis_length, major_axis_plunge, major_axis_azimuth,
+			major_axis_rotation, confidence_level, preferred_description, agency_id, author, creation_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			o.PublicID, eid, o.Time.Value.Format(time.RFC3339Nano), o.Latitude.Value, o.Latitude.Uncertainty,
+			o.Longitude.Value, o.Longitude.Uncertainty, o.Depth.Value, o.Depth.Uncertainty, o.Quality.AssociatedPhaseCount,
+			o.Quality.UsedPhaseCount, o.Quality.AssociatedStationCount, o.Quality.UsedStationCount, o.Quality.StandardError,
+			o.Quality.AzimuthalGap, o.Quality.SecondaryAzimuthalGap, o.Quality.GroundTruthLevel, o.Quality.MinimumDistance,
+			o.Quality.MedianDistance, o.Quality.MaximumDistance, o.MethodID, o.EarthModelID, o.EvaluationMode,
+			o.EvaluationStatus, o.Uncertainty.HorizontalUncertainty, o.Uncertainty.MinHorizontalUncertainty,
+			o.Uncertainty.MaxHorizontalUncertainty, o.Uncertainty.AzimuthMaxHorizontalUncertainty,
+			o.Uncertainty.ConfidenceEllipsoid.SemiMajorAxisLength, o.Uncertainty.ConfidenceEllipsoid.SemiMinorAxisLength,
+			o.Uncertainty.ConfidenceEllipsoid.SemiIntermediateAxisLength, o.Uncertainty.ConfidenceEllipsoid.MajorAxisPlunge,
+			o.Uncertainty.ConfidenceEllipsoid.MajorAxisAzimuth, o.Uncertainty.ConfidenceEllipsoid.MajorAxisRotation,
+			o.Uncertainty.ConfidenceLevel, o.Uncertainty.PreferredDescription,
+			o.CreationInfo.AgencyID, o.CreationInfo.Author, timeOrNull(o.CreationInfo.CreationTime))
+		if err != nil {
+			return err
+		}
+
+		for _, a := range o.Arrivals {
+			// Only arrivals for picks in the document can satisfy the foreign key.
+			if _, ok := d.Picks[a.PickID]; !ok {
+				continue
+			}
+			_, err = tx.Exec(`INSERT OR REPLACE INTO arrival (origin_id, pick_id, phase, azimuth, distance, time_residual,
+				time_weight, time_correction, takeoff_angle, horizontal_slowness_residual, backazimuth_residual,
+				horizontal_slowness_weight, backazimuth_weight, earth_model_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				o.PublicID, a.PickID, a.Phase, a.Azimuth, a.Distance, a.TimeResidual, a.TimeWeight, a.TimeCorrection,
+				a.TakeoffAngle.Value, a.HorizontalSlownessResidual, a.BackazimuthResidual, a.HorizontalSlownessWeight,
+				a.BackazimuthWeight, a.EarthModelID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, m := range d.M {
+		// Only magnitudes for origins in the document can satisfy the foreign key.
+		var oid interface{}
+		if _, ok := d.Origins[m.OriginID]; ok {
+			oid = m.OriginID
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO magnitude (publicid, event_id, origin_id, type, value, uncertainty,
+			method_id, station_count, agency_id, author, creation_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.PublicID, eid, oid, m.Type, m.Mag.Value, m.Mag.Uncertainty, m.MethodID, m.StationCount,
+			m.CreationInfo.AgencyID, m.CreationInfo.Author, timeOrNull(m.CreationInfo.CreationTime))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sm := range d.SM {
+		var oid interface{}
+		if _, ok := d.Origins[sm.OriginID]; ok {
+			oid = sm.OriginID
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO station_magnitude (publicid, event_id, origin_id, type, value, amplitude_id,
+			method_id, network_code, station_code, location_code, channel_code, agency_id, author, creation_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sm.PublicID, eid, oid, sm.Type, sm.Mag.Value, sm.AmplitudeID, sm.MethodID, sm.WaveformID.NetworkCode,
+			sm.WaveformID.StationCode, sm.WaveformID.LocationCode, sm.WaveformID.ChannelCode,
+			sm.CreationInfo.AgencyID, sm.CreationInfo.Author, timeOrNull(sm.CreationInfo.CreationTime))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range d.M {
+		for _, c := range m.Contributions {
+			if c.StationMagnitude == nil {
+				continue
+			}
+			_, err = tx.Exec(`INSERT OR REPLACE INTO station_magnitude_contribution (magnitude_id, station_magnitude_id,
+				residual, weight) VALUES (?, ?, ?, ?)`,
+				m.PublicID, c.StationMagnitudeID, c.StationMagnitude.Mag.Value-m.Mag.Value, c.Weight)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range d.FM {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO focal_mechanism (publicid, event_id, triggering_origin_id, strike1, dip1, rake1,
+			strike2, dip2, rake2, preferred_plane, t_axis_azimuth, t_axis_plunge, t_axis_length, p_axis_azimuth, p_axis_plunge,
+			p_axis_length, n_axis_azimuth, n_axis_plunge, n_axis_length, azimuthal_gap, station_polarity_count, misfit,
+			method_id, evaluation_mode, evaluation_status, agency_id, author, creation_time)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.PublicID, eid, f.TriggeringOriginID, f.NodalPlanes.NodalPlane1.Strike.Value, f.NodalPlanes.NodalPlane1.Dip.Value,
+			f.NodalPlanes.NodalPlane1.Rake.Value, f.NodalPlanes.NodalPlane2.Strike.Value, f.NodalPlanes.NodalPlane2.Dip.Value,
+			f.NodalPlanes.NodalPlane2.Rake.Value, f.NodalPlanes.PreferredPlane, f.PrincipalAxes.TAxis.Azimuth.Value,
+			f.PrincipalAxes.TAxis.Plunge.Value, f.PrincipalAxes.TAxis.Length.Value, f.PrincipalAxes.PAxis.Azimuth.Value,
+			f.PrincipalAxes.PAxis.Plunge.Value, f.PrincipalAxes.PAxis.Length.Value, f.PrincipalAxes.NAxis.Azimuth.Value,
+			f.PrincipalAxes.NAxis.Plunge.Value, f.PrincipalAxes.NAxis.Length.Value, f.AzimuthalGap, f.StationPolarityCount,
+			f.Misfit, f.MethodID, f.EvaluationMode, f.EvaluationStatus,
+			f.CreationInfo.AgencyID, f.CreationInfo.Author, timeOrNull(f.CreationInfo.CreationTime))
+		if err != nil {
+			return err
+		}
+
+		for _, mt := range f.MomentTensors {
+			_, err = tx.Exec(`INSERT OR REPLACE INTO moment_tensor (publicid, focal_mechanism_id, derived_origin_id,
+				moment_magnitude_id, scalar_moment, mrr, mtt, mpp, mrt, mrp, mtp, variance_reduction, double_couple, clvd,
+				method_id, agency_id, author, creation_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				mt.PublicID, f.PublicID, mt.DerivedOriginID, mt.MomentMagnitudeID, mt.ScalarMoment.Value, mt.Tensor.Mrr.Value,
+				mt.Tensor.Mtt.Value, mt.Tensor.Mpp.Value, mt.Tensor.Mrt.Value, mt.Tensor.Mrp.Value, mt.Tensor.Mtp.Value,
+				mt.VarianceReduction, mt.DoubleCouple, mt.CLVD, mt.MethodID,
+				mt.CreationInfo.AgencyID, mt.CreationInfo.Author, timeOrNull(mt.CreationInfo.CreationTime))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// migrate adds any missing columns to the tables.
+func migrate(db *sql.DB) error {
+	for _, c := range columns {
+		var n int
+		err := db.QueryRow(`SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.name).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err = db.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.name + ` ` + c.decl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timeOrNull formats t for the database or returns NULL if it is not set.
+func timeOrNull(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// null returns nil for an empty string so that missing values are stored as NULL.
+func null(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCache sets seiscompml07.CacheDir to a temporary directory with a copy of the SeisCompML test
+// documents for the eventids.  The copies are used because the cache is expired by modification time.
+// cleanup removes the directory.
+func testCache(t *testing.T, eventid ...string) (cleanup func()) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range eventid {
+		b, err := ioutil.ReadFile(filepath.Join("seiscompml07", "etc", v+".xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, v+".xml"), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seiscompml07.CacheDir = dir
+
+	return func() {
+		seiscompml07.CacheDir = ""
+		os.RemoveAll(dir)
+	}
+}
+
+// testDetails returns the quake details for the eventids from the SeisCompML test documents.
+func testDetails(t *testing.T, eventid ...string) map[string]seiscompml07.Event {
+	defer testCache(t, eventid...)()
+
+	d := seiscompml07.Get(eventid)
+	if len(d) != len(eventid) {
+		t.Fatal("expected details for ", eventid, ", got ", len(d))
+	}
+
+	return d
+}
+
+func TestWriteSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "quakes.db")
+
+	d := testDetails(t, "2012p070732-sc3")
+
+	quakes := []map[string]string{
+		{"EventID": "2012p070732-sc3", "EventType": "earthquake", "OriginTime": "2012-01-27T04:06:25.369Z", "Magnitude": "2.65"},
+		{"EventID": "2014p549333", "EventType": "earthquake", "OriginTime": "2014-07-23T06:04:43.625Z", "Magnitude": "2.64"},
+	}
+
+	if err = writeSQLite(name, quakes, d); err != nil {
+		t.Fatal(err)
+	}
+
+	first := tableCounts(t, name)
+
+	for k, v := range map[string]int{"event": 2, "origin": 4, "magnitude": 8, "pick": 10, "amplitude": 10} {
+		if first[k] != v {
+			t.Errorf("%s expected %d rows, got %d", k, v, first[k])
+		}
+	}
+
+	if first["arrival"] == 0 {
+		t.Error("expected arrivals")
+	}
+
+	// Writing the same quakes again replaces the rows rather than adding to them.
+	quakes[0]["EventType"] = "not existing"
+
+	if err = writeSQLite(name, quakes, d); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range tableCounts(t, name) {
+		if first[k] != v {
+			t.Errorf("%s expected %d rows after the second write, got %d", k, first[k], v)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", name+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var eventType string
+	if err = db.QueryRow(`SELECT event_type FROM event WHERE publicid = '2012p070732-sc3'`).Scan(&eventType); err != nil {
+		t.Fatal(err)
+	}
+
+	if eventType != "not existing" {
+		t.Error("event_type expected not existing, got ", eventType)
+	}
+
+	// Without details the rows for the event are kept.
+	if err = writeSQLite(name, quakes, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := tableCounts(t, name); c["origin"] != first["origin"] || c["pick"] != first["pick"] {
+		t.Error("expected the details to be kept without details, got ", c)
+	}
+
+	// Deleting an event deletes everything that belongs to it.
+	if _, err = db.Exec(`DELETE FROM event WHERE publicid = '2012p070732-sc3'`); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range tableCounts(t, name) {
+		if k != "event" && v != 0 {
+			t.Errorf("%s expected 0 rows after deleting the event, got %d", k, v)
+		}
+	}
+}
+
+// tableCounts returns the number of rows in the event tables in the SQLite database name.
+func tableCounts(t *testing.T, name string) map[string]int {
+	db, err := sql.Open("sqlite3", name+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c := make(map[string]int)
+
+	for _, v := range []string{"event", "origin", "magnitude", "station_magnitude", "amplitude", "pick", "arrival"} {
+		var n int
+		if err = db.QueryRow(`SELECT count(*) FROM ` + v).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		c[v] = n
+	}
+
+	return c
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "quakes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// An origin table from before the location was in the schema.
+	if _, err = db.Exec(`CREATE TABLE origin (publicid TEXT PRIMARY KEY, event_id TEXT NOT NULL, time TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{"latitude", "depth_uncertainty", "horizontal_uncertainty", "creation_time"} {
+		var n int
+		if err = db.QueryRow(`SELECT count(*) FROM pragma_table_info('origin') WHERE name = ?`, c).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Error("expected column origin.", c)
+		}
+	}
+
+	// Migrating again does nothing.
+	if err = migrate(db); err != nil {
+		t.Error(err)
+	}
+}
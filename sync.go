@@ -0,0 +1,492 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mirrorFormat is the columns in events.csv in a sync directory.
+const mirrorFormat = "EventID,EventType,OriginTime,ModificationTime,Latitude,Longitude,Depth,Magnitude,MagnitudeType," +
+	"MagnitudeUncertainty,MagnitudeStationCount,EvaluationMethod,EvaluationStatus,EvaluationMode,EarthModel,DepthType," +
+	"OriginError,UsedPhaseCount,UsedStationCount,MinimumDistance,AzimuthalGap,Description"
+
+// changeFormat is the columns in changes.csv in a sync directory.
+const changeFormat = "SyncTime,EventID,Change,EventType,PreviousEventType,ModificationTime"
+
+// notExisting is the event type for quakes that have been deleted.
+const notExisting = "not existing"
+
+// The kinds of change found by sync.  A deleted quake has had its type changed to not existing.
+const (
+	changeNew     = "new"
+	changeUpdated = "updated"
+	changeType    = "type"
+	changeDeleted = "deleted"
+)
+
+// mirrored is a quake in the local mirror.
+type mirrored struct {
+	eventType string
+	modified  string
+}
+
+// change is a quake that is new or has changed since it was mirrored.
+type change struct {
+	eventID   string
+	kind      string
+	eventType string
+	previous  string
+	modified  string
+}
+
+// syncCommand keeps a local mirror of the quakes and their details up to date.  Only quakes that have
+// been modified since the last sync are searched for.
+func syncCommand(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+
+	var s search
+	var since, dir, db string
+
+	s.addFlags(fs)
+	fs.StringVar(&since, "since", "",
+		"only search for quakes modified at or after this time in ISO8601 format e.g., 2014-02-22T04:06:25Z.  The default is shortly before the latest modification time in the mirror.")
+	fs.StringVar(&dir, "dir", "",
+		"mirror the quakes in this directory; events.csv, the quake details in xml/<eventid>.xml, and changes.csv.")
+	fs.StringVar(&db, "sqlite", "", "mirror the quakes in this SQLite database.  The changes are in the event_change table.")
+	fs.Usage = usage(fs, "sync [flags]", commands["sync"].about)
+
+	if a := parseFlags(fs, args); len(a) > 0 {
+		log.Fatalf("unexpected arguments for sync: %v", a)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	switch {
+	case (dir == "") == (db == ""):
+		log.Fatal("sync needs one of --dir or --sqlite.")
+	case anySet(set, eventidFlags):
+		log.Fatal("--eventid, --eventid-file, and --fdsn can't be used with sync.")
+	case backend != "wfs":
+		log.Fatalf("--backend %s has no modification times and can't be used with sync.", backend)
+	case s.start == "":
+		// The WFS is searched a year at a time so the start of the mirror is needed.
+		log.Fatal("sync needs --start.")
+	}
+
+	var index map[string]mirrored
+	var err error
+
+	if dir != "" {
+		index, err = readDirIndex(dir)
+	} else {
+		index, err = readSQLiteIndex(db)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+
+	// Without --end the mirror is kept up to date.
+	if s.end == "" {
+		s.end = now.Add(time.Hour).Format(time.RFC3339)
+	}
+
+	query, err := s.query(fs, true)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if query.ModifiedSince, err = syncSince(since, index); err != nil {
+		log.Fatal(err)
+	}
+
+	infof("Searching for quakes modified since %s", query.ModifiedSince.Format(time.RFC3339))
+
+	props, err := searchQuakes(query)
+	if err != nil {
+		log.Println("Error searching for quakes.")
+		log.Fatal(err)
+	}
+
+	c := modified(index, props)
+
+	infof("Found %d new or changed quakes", len(c))
+
+	if len(c) == 0 {
+		return
+	}
+
+	// The details of changed quakes are always fetched again.  They are fetched into a temporary
+	// directory so that the mirrored details are kept if a fetch fails.
+	if dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	tmp, err := ioutil.TempDir(dir, "xml-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	seiscompml07.CacheDir = tmp
+
+	r := findDetails(c, &outputs{}, true)
+
+	quakes, changes := mirrorQuakes(r.quakes, findChanges(index, r.quakes), r.details)
+
+	if len(quakes) < len(c) {
+		warnf("Not mirroring %d quakes without details.  Sync again with --since %s to retry them.",
+			len(c)-len(quakes), query.ModifiedSince.Format(time.RFC3339))
+	}
+
+	if dir != "" {
+		if err = moveDetails(tmp, filepath.Join(dir, "xml"), r.details); err == nil {
+			err = writeDirMirror(dir, quakes, changes, now)
+		}
+	} else {
+		err = writeSQLiteMirror(db, quakes, r.details, tmp, changes, now)
+	}
+
+	os.RemoveAll(tmp)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// moveDetails moves the SeisCompML for the quakes in details from the directory tmp to dir.
+func moveDetails(tmp, dir string, details map[string]seiscompml07.Event) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for k := range details {
+		if err := os.Rename(filepath.Join(tmp, k+".xml"), filepath.Join(dir, k+".xml")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mirrorQuakes returns the quakes and their changes to mirror.  Quakes without details are left out
+// so that they are searched for again, except for deletions and type changes, which are mirrored
+// from the WFS.  A type change without details has no modification time in the mirror so that the
+// next sync fetches its details.
+func mirrorQuakes(quakes []map[string]string, changes []change, details map[string]seiscompml07.Event) (q []map[string]string, c []change) {
+	for i, v := range quakes {
+		if _, ok := details[v["EventID"]]; !ok {
+			switch {
+			case v["EventType"] == notExisting:
+			case changes[i].kind == changeType:
+				m := make(map[string]string, len(v))
+				for k, x := range v {
+					m[k] = x
+				}
+				m["ModificationTime"] = ""
+				v = m
+			default:
+				continue
+			}
+		}
+
+		q = append(q, v)
+		c = append(c, changes[i])
+	}
+
+	return q, c
+}
+
+// syncSince returns the modification time to search from.  It is since if that is set and otherwise
+// followOverlap before the latest modification time in the index.  The time is zero for an empty index.
+func syncSince(since string, index map[string]mirrored) (t time.Time, err error) {
+	if since != "" {
+		return time.Parse(time.RFC3339, since)
+	}
+
+	for _, v := range index {
+		if m, err := time.Parse(time.RFC3339Nano, v.modified); err == nil && m.After(t) {
+			t = m
+		}
+	}
+
+	if t.IsZero() {
+		return t, nil
+	}
+
+	return t.Add(-followOverlap), nil
+}
+
+// modified returns the quakes in p that are not in the index or have a different modification time.
+func modified(index map[string]mirrored, p []wfs.Properties) (c []wfs.Properties) {
+	for _, v := range p {
+		if m, ok := index[v.PublicID]; !ok || m.modified != v.ModificationTime {
+			c = append(c, v)
+		}
+	}
+
+	return c
+}
+
+// findChanges returns the change to the index for each of the quakes.  The event type is compared after
+// it has been merged from the quake details as it is for the mirror.
+func findChanges(index map[string]mirrored, quakes []map[string]string) (c []change) {
+	for _, v := range quakes {
+		m, ok := index[v["EventID"]]
+		t := v["EventType"]
+
+		var kind string
+
+		switch {
+		case !ok:
+			kind = changeNew
+		case t == notExisting && m.eventType != notExisting:
+			kind = changeDeleted
+		case t != m.eventType:
+			kind = changeType
+		default:
+			kind = changeUpdated
+		}
+
+		c = append(c, change{eventID: v["EventID"], kind: kind, eventType: t, previous: m.eventType, modified: v["ModificationTime"]})
+	}
+
+	return c
+}
+
+// readDirIndex returns the quakes in events.csv in dir.  The index is empty if the file does not exist.
+func readDirIndex(dir string) (index map[string]mirrored, err error) {
+	index = make(map[string]mirrored)
+
+	rows, err := readCSV(filepath.Join(dir, "events.csv"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range rows {
+		index[v["EventID"]] = mirrored{eventType: v["EventType"], modified: v["ModificationTime"]}
+	}
+
+	return index, nil
+}
+
+// readCSV returns the rows in the CSV file name as maps from the header line.  There are no rows if
+// the file does not exist.
+func readCSV(name string) (rows []map[string]string, err error) {
+	f, err := os.Open(name)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+
+	h, err := r.Read()
+	switch {
+	case err == io.EOF:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	for {
+		l, err := r.Read()
+		switch {
+		case err == io.EOF:
+			return rows, nil
+		case err != nil:
+			return nil, err
+		}
+
+		v := make(map[string]string, len(h))
+		for i, n := range h {
+			v[n] = l[i]
+		}
+		rows = append(rows, v)
+	}
+}
+
+// writeDirMirror merges the quakes into events.csv in dir and appends the changes to changes.csv.
+// events.csv is replaced when it is complete so an interrupted sync does not lose the mirror.
+func writeDirMirror(dir string, quakes []map[string]string, changes []change, synced time.Time) error {
+	name := filepath.Join(dir, "events.csv")
+
+	rows, err := readCSV(name)
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[string]map[string]string)
+	for _, v := range quakes {
+		updated[v["EventID"]] = v
+	}
+
+	for i, v := range rows {
+		if u, ok := updated[v["EventID"]]; ok {
+			rows[i] = u
+			delete(updated, v["EventID"])
+		}
+	}
+
+	for _, v := range quakes {
+		if _, ok := updated[v["EventID"]]; ok {
+			rows = append(rows, v)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if c := compareValues(rows[i]["OriginTime"], rows[j]["OriginTime"], false); c != 0 {
+			return c < 0
+		}
+		return rows[i]["EventID"] < rows[j]["EventID"]
+	})
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	err = writeFile(name+".tmp", func(f *os.File) error {
+		return writeCSV(f, strings.Split(mirrorFormat, ","), rows, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	name = filepath.Join(dir, "changes.csv")
+
+	_, err = os.Stat(name)
+	header := os.IsNotExist(err)
+
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err = writeCSV(f, strings.Split(changeFormat, ","), changeRows(changes, synced), header); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// changeRows returns the changes as rows for changeFormat.
+func changeRows(changes []change, synced time.Time) (rows []map[string]string) {
+	for _, c := range changes {
+		rows = append(rows, map[string]string{
+			"SyncTime":          synced.Format(time.RFC3339),
+			"EventID":           c.eventID,
+			"Change":            c.kind,
+			"EventType":         c.eventType,
+			"PreviousEventType": c.previous,
+			"ModificationTime":  c.modified,
+		})
+	}
+
+	return rows
+}
+
+// readSQLiteIndex returns the quakes in the SQLite database name.  The database is created if it does
+// not exist.
+func readSQLiteIndex(name string) (index map[string]mirrored, err error) {
+	db, err := sql.Open("sqlite3", name+"?_foreign_keys=1")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(schema); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT publicid, coalesce(event_type, ''), coalesce(modification_time, '') FROM event`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index = make(map[string]mirrored)
+
+	for rows.Next() {
+		var id string
+		var m mirrored
+		if err = rows.Scan(&id, &m.eventType, &m.modified); err != nil {
+			return nil, err
+		}
+		index[id] = m
+	}
+
+	return index, rows.Err()
+}
+
+// writeSQLiteMirror upserts the quakes and their details into the SQLite database name and records
+// the changes in the event_change table.  The SeisCompML for the quakes in details is read from the
+// directory docs and stored in the event_document table.
+func writeSQLiteMirror(name string, quakes []map[string]string, details map[string]seiscompml07.Event, docs string,
+	changes []change, synced time.Time) error {
+	if err := writeSQLite(name, quakes, details); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", name+"?_foreign_keys=1")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range changeRows(changes, synced) {
+		_, err = tx.Exec(`INSERT INTO event_change (sync_time, event_id, change, event_type, previous_event_type, modification_time)
+			VALUES (?, ?, ?, ?, ?, ?)`, v["SyncTime"], v["EventID"], v["Change"], null(v["EventType"]),
+			null(v["PreviousEventType"]), null(v["ModificationTime"]))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, v := range quakes {
+		if _, ok := details[v["EventID"]]; !ok {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(docs, v["EventID"]+".xml"))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO event_document (event_id, document) VALUES (?, ?)
+			ON CONFLICT(event_id) DO UPDATE SET document = excluded.document`, v["EventID"], string(b))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
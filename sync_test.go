@@ -0,0 +1,265 @@
+package main
+
+import (
+	"database/sql"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncSince(t *testing.T) {
+	index := map[string]mirrored{
+		"a": {modified: "2014-07-23T06:04:43.625Z"},
+		"b": {modified: "2014-07-23T07:00:00Z"},
+		"c": {modified: ""},
+	}
+
+	for _, v := range []struct {
+		since string
+		index map[string]mirrored
+		t     string
+		err   bool
+	}{
+		{"2014-01-01T00:00:00Z", index, "2014-01-01T00:00:00Z", false},
+		// The overlap before the latest modification time.
+		{"", index, "2014-07-23T06:50:00Z", false},
+		{"", map[string]mirrored{}, "0001-01-01T00:00:00Z", false},
+		{"2014-01-01", index, "", true},
+	} {
+		s, err := syncSince(v.since, v.index)
+
+		switch {
+		case v.err && err == nil:
+			t.Errorf("syncSince(%q) expected an error", v.since)
+		case v.err:
+		case err != nil:
+			t.Errorf("syncSince(%q): %v", v.since, err)
+		case s.Format(time.RFC3339) != v.t:
+			t.Errorf("syncSince(%q) expected %s, got %s", v.since, v.t, s.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestModified(t *testing.T) {
+	index := map[string]mirrored{
+		"a": {modified: "2014-07-23T06:04:43.625Z"},
+		"b": {modified: "2014-07-23T07:00:00Z"},
+	}
+
+	p := []wfs.Properties{
+		{PublicID: "a", ModificationTime: "2014-07-23T06:04:43.625Z"},
+		{PublicID: "b", ModificationTime: "2014-07-23T07:10:00Z"},
+		{PublicID: "c", ModificationTime: "2014-07-23T07:20:00Z"},
+	}
+
+	c := modified(index, p)
+
+	if len(c) != 2 || c[0].PublicID != "b" || c[1].PublicID != "c" {
+		t.Error("expected b and c to be modified, got ", c)
+	}
+}
+
+func TestFindChanges(t *testing.T) {
+	index := map[string]mirrored{
+		"a": {eventType: "earthquake"},
+		"b": {eventType: "earthquake"},
+		"c": {eventType: "earthquake"},
+		"d": {eventType: notExisting},
+	}
+
+	quakes := []map[string]string{
+		{"EventID": "a", "EventType": "earthquake", "ModificationTime": "2014-07-23T06:04:43.625Z"},
+		{"EventID": "b", "EventType": "quarry blast"},
+		{"EventID": "c", "EventType": notExisting},
+		{"EventID": "d", "EventType": notExisting},
+		{"EventID": "e", "EventType": "earthquake"},
+	}
+
+	c := findChanges(index, quakes)
+
+	if len(c) != len(quakes) {
+		t.Fatal("expected a change for each quake, got ", len(c))
+	}
+
+	for i, v := range []change{
+		{eventID: "a", kind: changeUpdated, eventType: "earthquake", previous: "earthquake", modified: "2014-07-23T06:04:43.625Z"},
+		{eventID: "b", kind: changeType, eventType: "quarry blast", previous: "earthquake"},
+		{eventID: "c", kind: changeDeleted, eventType: notExisting, previous: "earthquake"},
+		// Already deleted.
+		{eventID: "d", kind: changeUpdated, eventType: notExisting, previous: notExisting},
+		{eventID: "e", kind: changeNew, eventType: "earthquake"},
+	} {
+		if c[i] != v {
+			t.Errorf("expected %+v, got %+v", v, c[i])
+		}
+	}
+}
+
+func TestMoveDetails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "xml-1")
+	x := filepath.Join(dir, "xml")
+
+	for _, v := range []string{tmp, x} {
+		if err = os.MkdirAll(v, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for n, b := range map[string]string{
+		filepath.Join(tmp, "a.xml"): "new a",
+		filepath.Join(x, "a.xml"):   "old a",
+		filepath.Join(x, "b.xml"):   "old b",
+	} {
+		if err = ioutil.WriteFile(n, []byte(b), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The details for b were not fetched so the mirrored details are kept.
+	if err = moveDetails(tmp, x, map[string]seiscompml07.Event{"a": {}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for n, v := range map[string]string{"a.xml": "new a", "b.xml": "old b"} {
+		if b, err := ioutil.ReadFile(filepath.Join(x, n)); err != nil || string(b) != v {
+			t.Errorf("%s expected %s, got %s %v", n, v, b, err)
+		}
+	}
+
+	// It is an error if the details were not saved.
+	if err = moveDetails(tmp, x, map[string]seiscompml07.Event{"c": {}}); err == nil {
+		t.Error("expected an error for missing details")
+	}
+}
+
+func TestMirrorQuakes(t *testing.T) {
+	index := map[string]mirrored{
+		"a": {eventType: "earthquake"},
+		"b": {eventType: "earthquake"},
+		"c": {eventType: "earthquake"},
+		"d": {eventType: "earthquake"},
+	}
+
+	quakes := []map[string]string{
+		{"EventID": "a", "EventType": "earthquake", "ModificationTime": "2014-07-23T07:00:00Z"},
+		// The rest have no details.
+		{"EventID": "b", "EventType": "earthquake", "ModificationTime": "2014-07-23T07:00:00Z"},
+		{"EventID": "c", "EventType": notExisting, "ModificationTime": "2014-07-23T07:00:00Z"},
+		{"EventID": "d", "EventType": "quarry blast", "ModificationTime": "2014-07-23T07:00:00Z"},
+		{"EventID": "e", "EventType": "earthquake", "ModificationTime": "2014-07-23T07:00:00Z"},
+		{"EventID": "f", "EventType": notExisting, "ModificationTime": "2014-07-23T07:00:00Z"},
+	}
+
+	q, c := mirrorQuakes(quakes, findChanges(index, quakes), map[string]seiscompml07.Event{"a": {}})
+
+	if len(q) != len(c) {
+		t.Fatal("expected a change for each quake, got ", len(q), len(c))
+	}
+
+	var ids string
+	for i, v := range q {
+		if v["EventID"] != c[i].eventID {
+			t.Error("expected the change for ", v["EventID"], ", got ", c[i].eventID)
+		}
+		ids += v["EventID"]
+	}
+
+	// Updates and new quakes without details are left out so that they are retried.
+	if ids != "acdf" {
+		t.Error("expected a, c, d, and f to be mirrored, got ", ids)
+	}
+
+	for i, v := range []struct {
+		kind, modified string
+	}{
+		{changeUpdated, "2014-07-23T07:00:00Z"},
+		{changeDeleted, "2014-07-23T07:00:00Z"},
+		// The details for a type change are fetched again by the next sync.
+		{changeType, ""},
+		{changeNew, "2014-07-23T07:00:00Z"},
+	} {
+		if c[i].kind != v.kind || q[i]["ModificationTime"] != v.modified {
+			t.Errorf("%s expected %s and modified %q, got %s %q", q[i]["EventID"], v.kind, v.modified, c[i].kind, q[i]["ModificationTime"])
+		}
+	}
+
+	// The change records the modification time from the WFS.
+	if c[2].modified != "2014-07-23T07:00:00Z" {
+		t.Error("expected the change modification time from the WFS, got ", c[2].modified)
+	}
+
+	if quakes[3]["ModificationTime"] != "2014-07-23T07:00:00Z" {
+		t.Error("expected the quakes not to be changed")
+	}
+}
+
+func TestWriteSQLiteMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "quakes.db")
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "a.xml"), []byte("<seiscomp/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	quakes := []map[string]string{
+		{"EventID": "a", "EventType": "earthquake", "ModificationTime": "2014-07-23T07:00:00Z"},
+		// Deleted without details.
+		{"EventID": "b", "EventType": notExisting, "ModificationTime": "2014-07-23T07:00:00Z"},
+	}
+
+	changes := findChanges(map[string]mirrored{"b": {eventType: "earthquake"}}, quakes)
+
+	synced := time.Date(2014, 7, 23, 8, 0, 0, 0, time.UTC)
+
+	if err = writeSQLiteMirror(name, quakes, map[string]seiscompml07.Event{"a": {}}, dir, changes, synced); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var doc string
+	if err = db.QueryRow(`SELECT document FROM event_document WHERE event_id = 'a'`).Scan(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc != "<seiscomp/>" {
+		t.Error("document expected <seiscomp/>, got ", doc)
+	}
+
+	var n int
+	if err = db.QueryRow(`SELECT count(*) FROM event_change WHERE event_id = 'b' AND change = 'deleted'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Error("expected the deletion of b to be recorded, got ", n)
+	}
+
+	index, err := readSQLiteIndex(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index["b"].eventType != notExisting {
+		t.Error("b expected not existing, got ", index["b"].eventType)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"io"
+	"io/ioutil"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// templateEvent is the typed event information available to --template.  The WFS properties are
+// promoted so that e.g., .PublicID and .Magnitude can be used directly.  Origin, FocalMechanism,
+// Picks, and Arrivals are only filled in if the template uses them.
+type templateEvent struct {
+	wfs.Properties
+	Time           time.Time
+	Origin         *seiscompml07.Origin
+	FocalMechanism *seiscompml07.FocalMechanism
+	Picks          []seiscompml07.Pick
+	Arrivals       []templateArrival
+}
+
+// templateArrival is an Arrival for the preferred origin.
+type templateArrival struct {
+	seiscompml07.Arrival
+	PhaseOriginOffset float64
+}
+
+// templateFuncs are the extra functions available in templates.
+var templateFuncs = template.FuncMap{
+	// deg2km converts an epicentral distance in degrees to km.
+	"deg2km": func(d float64) float64 {
+		return d * kmPerDegree
+	},
+}
+
+// parseTemplate parses the template text or, if text is empty, the template in file.
+func parseTemplate(text, file string) (*template.Template, error) {
+	if text == "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+
+	return template.New("qsearch").Funcs(templateFuncs).Parse(text)
+}
+
+// detailFields are the fields of templateEvent that are only available from the quake details.
+var detailFields = map[string]bool{"Origin": true, "FocalMechanism": true, "Picks": true, "Arrivals": true}
+
+// templateDetails returns true if t uses information that is only available from the quake details.
+func templateDetails(t *template.Template) bool {
+	if t == nil {
+		return false
+	}
+
+	for _, d := range t.Templates() {
+		if d.Tree != nil && usesDetails(d.Tree.Root) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usesDetails returns true if a field in detailFields is used in the template node n.
+func usesDetails(n parse.Node) bool {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, v := range n.Nodes {
+			if usesDetails(v) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesDetails(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, v := range n.Cmds {
+			if usesDetails(v) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, v := range n.Args {
+			if usesDetails(v) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return usesBranchDetails(&n.BranchNode)
+	case *parse.RangeNode:
+		return usesBranchDetails(&n.BranchNode)
+	case *parse.WithNode:
+		return usesBranchDetails(&n.BranchNode)
+	case *parse.TemplateNode:
+		return usesDetails(n.Pipe)
+	case *parse.FieldNode:
+		return anyDetailField(n.Ident)
+	case *parse.ChainNode:
+		return usesDetails(n.Node) || anyDetailField(n.Field)
+	case *parse.VariableNode:
+		// The first ident is the variable name e.g., $e in $e.Origin.
+		return anyDetailField(n.Ident[1:])
+	}
+
+	return false
+}
+
+// usesBranchDetails returns true if the pipeline or either list of an if, range, or with uses the quake details.
+func usesBranchDetails(n *parse.BranchNode) bool {
+	return usesDetails(n.Pipe) || usesDetails(n.List) || usesDetails(n.ElseList)
+}
+
+// anyDetailField returns true if any of the field names is in detailFields.
+func anyDetailField(names []string) bool {
+	for _, v := range names {
+		if detailFields[v] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// executeTemplate executes t with .Events for the quakes in props.
+func executeTemplate(w io.Writer, t *template.Template, props []wfs.Properties, qDetails map[string]seiscompml07.Event) error {
+	events := make([]templateEvent, len(props))
+
+	for i, p := range props {
+		e := templateEvent{Properties: p}
+		e.Time, _ = time.Parse(time.RFC3339Nano, p.OriginTime)
+
+		if d, ok := qDetails[p.PublicID]; ok {
+			e.Origin = d.PreferredOrigin
+			e.FocalMechanism = d.PreferredFocalMechanism
+			e.Picks = d.P
+			if o := d.PreferredOrigin; o != nil {
+				for _, a := range o.Arrivals {
+					ta := templateArrival{Arrival: a}
+					if a.Pick != nil {
+						ta.PhaseOriginOffset = a.Pick.Time.Value.Sub(o.Time.Value).Seconds()
+					}
+					e.Arrivals = append(e.Arrivals, ta)
+				}
+			}
+		}
+
+		events[i] = e
+	}
+
+	return t.Execute(w, struct{ Events []templateEvent }{events})
+}
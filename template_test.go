@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"github.com/GeoNet/qsearch/seiscompml07"
+	"github.com/GeoNet/qsearch/wfs"
+	"testing"
+)
+
+func TestTemplateDetails(t *testing.T) {
+	for _, v := range []struct {
+		text    string
+		details bool
+	}{
+		{`{{range .Events}}{{.PublicID}} {{.OriginTime}}{{end}}`, false},
+		{`{{range .Events}}{{.OriginError}} {{.Time.Year}}{{end}}`, false},
+		{`{{range .Events}}{{.Origin.Depth.Value}}{{end}}`, true},
+		{`{{range .Events}}{{range .Arrivals}}{{.Phase}}{{end}}{{end}}`, true},
+		{`{{range $e := .Events}}{{len $e.Picks}}{{end}}`, true},
+		{`{{range .Events}}{{if .FocalMechanism}}fm{{end}}{{end}}`, true},
+		{`{{range .Events}}{{if gt .Magnitude 3.0}}big{{else}}{{.Origin}}{{end}}{{end}}`, true},
+		{`{{define "o"}}{{.Origin.PublicID}}{{end}}{{range .Events}}{{template "o" .}}{{end}}`, true},
+		{`{{range .Events}}{{with .Origin}}{{.PublicID}}{{end}}{{end}}`, true},
+		{`{{range .Events}}{{(index $.Events 0).Picks}}{{end}}`, true},
+	} {
+		tm, err := parseTemplate(v.text, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if templateDetails(tm) != v.details {
+			t.Errorf("%s expected details %t", v.text, v.details)
+		}
+	}
+
+	if templateDetails(nil) {
+		t.Error("expected no details for no template")
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	tm, err := parseTemplate(`{{range .Events}}{{.PublicID}} {{len .Arrivals}}{{"\n"}}{{end}}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props := []wfs.Properties{{PublicID: "2012p070732"}, {PublicID: "2014p549333"}}
+
+	// The preferred origin doesn't resolve for 2014p549333.
+	d := map[string]seiscompml07.Event{
+		"2012p070732": {PreferredOrigin: &seiscompml07.Origin{Arrivals: []seiscompml07.Arrival{{Phase: "P"}}}},
+		"2014p549333": {},
+	}
+
+	var b bytes.Buffer
+
+	if err = executeTemplate(&b, tm, props, d); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "2012p070732 1\n2014p549333 0\n" {
+		t.Error("incorrect template output, got ", b.String())
+	}
+}
@@ -4,23 +4,59 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/GeoNet/qsearch/progress"
 	"io/ioutil"
-	"log"
+	"math"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-const wfsUrl = "http://wfs.geonet.org.nz/geonet/ows?service=WFS&version=1.0.0&request=GetFeature&typeName=geonet:quake_search_v1&outputFormat=json"
+// URL is the WFS that is searched.
+var URL = "http://wfs.geonet.org.nz/geonet/ows?service=WFS&version=1.0.0&request=GetFeature&typeName=geonet:quake_search_v1&outputFormat=json"
 
-// Query parameters for querying the WFS.
+// Progress is called with the URLs that are fetched and the number of quakes found as a search
+// progresses.
+var Progress progress.Func = progress.Log
+
+// eventIDBatch is the maximum number of EventIDs in a single WFS query.
+const eventIDBatch = 50
+
+// Query parameters for querying the WFS.  EventIDs is a list of events to search for.  It
+// takes precedence over EventID, which takes precedence over the other parameters.
+// MaxMagnitude, MinDepth, MaxDepth, and Circle are not used if they are nil.  If ModifiedSince is
+// not zero only quakes modified at or after it are found.
+//
+// The quakes found are ordered by OrderBy; time-asc (the default), time, magnitude, or magnitude-asc.
+// time and magnitude are in descending order.  Offset quakes are then skipped and at most Limit
+// quakes are returned if Limit is greater than 0.
 type Query struct {
+	EventIDs          []string
 	EventID           string
 	Start             time.Time
 	End               time.Time
 	MinUsedPhaseCount int
 	MinMagnitude      float64
+	MaxMagnitude      *float64
+	MinDepth          *float64
+	MaxDepth          *float64
 	Bbox              string
+	Circle            *Circle
+	ModifiedSince     time.Time
+	OrderBy           string
+	Offset            int
+	Limit             int
+}
+
+// Circle searches for quakes with an epicentre between MinRadius and MaxRadius degrees
+// from Latitude and Longitude.
+type Circle struct {
+	Latitude  float64
+	Longitude float64
+	MinRadius float64
+	MaxRadius float64
 }
 
 // Features is the top level container for unmarshalling the JSON returned from the WFS.
@@ -90,43 +126,163 @@ func EventFormat() (format map[string]string) {
 // structure of the returned map.
 func (q *Query) Get() (quakes []map[string]string, err error) {
 
-	f, err := q.search()
+	p, err := q.Properties()
 	if err != nil {
 		return nil, err
 	}
 
-	quakes = make([]map[string]string, len(f))
-
-	var i = 0
-	for p, ft := range f {
-		e := make(map[string]string)
-		e["EventID"] = p
-		e["EventType"] = ft.Properties.EventType
-		e["OriginTime"] = ft.Properties.OriginTime
-		e["ModificationTime"] = ft.Properties.ModificationTime
-		e["Latitude"] = fmt.Sprintf("%v", ft.Properties.Latitude)
-		e["Longitude"] = fmt.Sprintf("%v", ft.Properties.Longitude)
-		e["Depth"] = fmt.Sprintf("%f", ft.Properties.Depth)
-		e["Magnitude"] = fmt.Sprintf("%v", ft.Properties.Magnitude)
-		e["EvaluationMethod"] = ft.Properties.EvaluationMethod
-		e["EvaluationStatus"] = ft.Properties.EvaluationStatus
-		e["EvaluationMode"] = ft.Properties.EvaluationMode
-		e["EarthModel"] = ft.Properties.EarthModel
-		e["DepthType"] = ft.Properties.DepthType
-		e["OriginError"] = fmt.Sprintf("%v", ft.Properties.OriginError)
-		e["UsedPhaseCount"] = fmt.Sprintf("%v", ft.Properties.UsedPhaseCount)
-		e["UsedStationCount"] = fmt.Sprintf("%v", ft.Properties.UsedStationCount)
-		e["MinimumDistance"] = fmt.Sprintf("%v", ft.Properties.MinimumDistance)
-		e["AzimuthalGap"] = fmt.Sprintf("%v", ft.Properties.AzimuthalGap)
-		e["MagnitudeType"] = ft.Properties.MagnitudeType
-		e["MagnitudeUncertainty"] = fmt.Sprintf("%v", ft.Properties.MagnitudeUncertainty)
-		e["MagnitudeStationCount"] = fmt.Sprintf("%v", ft.Properties.MagnitudeStationCount)
-		quakes[i] = e
-		i++
+	quakes = make([]map[string]string, len(p))
+
+	for i := range p {
+		quakes[i] = p[i].Map()
 	}
 	return quakes, nil
 }
 
+// Properties searchs the WFS for quakes based on the query and returns the typed properties for each quake.
+// The quakes are ordered by OriginTime and then PublicID unless OrderBy is set.
+func (q *Query) Properties() (p []Properties, err error) {
+
+	f, err := q.search()
+	if err != nil {
+		return nil, err
+	}
+
+	p = make([]Properties, 0, len(f))
+
+	for _, ft := range f {
+		if q.Circle.contains(ft.Properties.Latitude, ft.Properties.Longitude) {
+			p = append(p, ft.Properties)
+		}
+	}
+
+	return q.Order(p)
+}
+
+// Order sorts p by OrderBy and then applies Offset and Limit.  It can be used to order the quakes
+// found by searching other services.
+func (q *Query) Order(p []Properties) ([]Properties, error) {
+	sortProperties(p)
+
+	switch q.OrderBy {
+	case "", "time-asc":
+	case "time":
+		for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+			p[i], p[j] = p[j], p[i]
+		}
+	case "magnitude":
+		sort.SliceStable(p, func(i, j int) bool { return p[i].Magnitude > p[j].Magnitude })
+	case "magnitude-asc":
+		sort.SliceStable(p, func(i, j int) bool { return p[i].Magnitude < p[j].Magnitude })
+	default:
+		return nil, errors.New("invalid OrderBy " + q.OrderBy)
+	}
+
+	if q.Offset >= len(p) {
+		return p[:0], nil
+	}
+
+	if q.Offset > 0 {
+		p = p[q.Offset:]
+	}
+
+	if q.Limit > 0 && len(p) > q.Limit {
+		p = p[:q.Limit]
+	}
+
+	return p, nil
+}
+
+// bbox returns a WFS BBOX that contains the circle c.  It is empty if c is nil or the circle
+// covers all longitudes and latitudes.  The quakes in the BBOX are then filtered with contains.
+func (c *Circle) bbox() string {
+	if c == nil || c.MaxRadius >= 180 {
+		return ""
+	}
+
+	minLat := math.Max(c.Latitude-c.MaxRadius, -90)
+	maxLat := math.Min(c.Latitude+c.MaxRadius, 90)
+	minLon, maxLon := -180.0, 180.0
+
+	// The longitude range only applies if the circle does not contain a pole.
+	if minLat > -90 && maxLat < 90 {
+		d := math.Asin(math.Sin(c.MaxRadius*math.Pi/180)/math.Cos(c.Latitude*math.Pi/180)) * 180 / math.Pi
+		if c.Longitude-d >= -180 && c.Longitude+d <= 180 {
+			minLon, maxLon = c.Longitude-d, c.Longitude+d
+		}
+	}
+
+	return fmt.Sprintf("%v,%v,%v,%v", minLon, minLat, maxLon, maxLat)
+}
+
+// contains returns true if latitude and longitude are inside the circle c or c is nil.
+func (c *Circle) contains(latitude, longitude float64) bool {
+	if c == nil {
+		return true
+	}
+
+	d := distance(c.Latitude, c.Longitude, latitude, longitude)
+
+	return d >= c.MinRadius && d <= c.MaxRadius
+}
+
+// distance returns the great circle distance in degrees between two points.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	r := math.Pi / 180
+	dLat := (lat2 - lat1) * r
+	dLon := (lon2 - lon1) * r
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*r)*math.Cos(lat2*r)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a)) / r
+}
+
+// sortProperties sorts p by OriginTime and then PublicID.  Origin times that can't be parsed
+// are compared as strings.
+func sortProperties(p []Properties) {
+	sort.SliceStable(p, func(i, j int) bool {
+		ti, erri := time.Parse(time.RFC3339Nano, p[i].OriginTime)
+		tj, errj := time.Parse(time.RFC3339Nano, p[j].OriginTime)
+
+		switch {
+		case erri == nil && errj == nil && !ti.Equal(tj):
+			return ti.Before(tj)
+		case (erri != nil || errj != nil) && p[i].OriginTime != p[j].OriginTime:
+			return p[i].OriginTime < p[j].OriginTime
+		}
+
+		return p[i].PublicID < p[j].PublicID
+	})
+}
+
+// Map remaps the Properties to allow for user selectable output.  Refer to EventFormat for the
+// structure of the returned map.
+func (p *Properties) Map() (e map[string]string) {
+	e = make(map[string]string)
+	e["EventID"] = p.PublicID
+	e["EventType"] = p.EventType
+	e["OriginTime"] = p.OriginTime
+	e["ModificationTime"] = p.ModificationTime
+	e["Latitude"] = fmt.Sprintf("%v", p.Latitude)
+	e["Longitude"] = fmt.Sprintf("%v", p.Longitude)
+	e["Depth"] = fmt.Sprintf("%f", p.Depth)
+	e["Magnitude"] = fmt.Sprintf("%v", p.Magnitude)
+	e["EvaluationMethod"] = p.EvaluationMethod
+	e["EvaluationStatus"] = p.EvaluationStatus
+	e["EvaluationMode"] = p.EvaluationMode
+	e["EarthModel"] = p.EarthModel
+	e["DepthType"] = p.DepthType
+	e["OriginError"] = fmt.Sprintf("%v", p.OriginError)
+	e["UsedPhaseCount"] = fmt.Sprintf("%v", p.UsedPhaseCount)
+	e["UsedStationCount"] = fmt.Sprintf("%v", p.UsedStationCount)
+	e["MinimumDistance"] = fmt.Sprintf("%v", p.MinimumDistance)
+	e["AzimuthalGap"] = fmt.Sprintf("%v", p.AzimuthalGap)
+	e["MagnitudeType"] = p.MagnitudeType
+	e["MagnitudeUncertainty"] = fmt.Sprintf("%v", p.MagnitudeUncertainty)
+	e["MagnitudeStationCount"] = fmt.Sprintf("%v", p.MagnitudeStationCount)
+	return e
+}
+
 // Unmarshal unmarshalls the JSON returned from the WFS.
 func unmarshal(b []byte) (fs []Feature, err error) {
 	var f Features
@@ -140,7 +296,9 @@ func unmarshal(b []byte) (fs []Feature, err error) {
 func (q *Query) url() string {
 	var s string
 
-	if q.EventID != "" {
+	if len(q.EventIDs) > 0 {
+		s = fmt.Sprintf("&cql_filter=publicid+IN+('%s')", strings.Join(q.EventIDs, "','"))
+	} else if q.EventID != "" {
 		s = fmt.Sprintf("&cql_filter=publicid=='%s'", q.EventID)
 	} else {
 		s = fmt.Sprintf("&cql_filter=origintime>='%s'+AND+origintime<='%s'",
@@ -152,16 +310,32 @@ func (q *Query) url() string {
 		if q.MinMagnitude != -999.9 {
 			s = fmt.Sprintf("%s+AND+magnitude>=%v", s, q.MinMagnitude)
 		}
+		if q.MaxMagnitude != nil {
+			s = fmt.Sprintf("%s+AND+magnitude<=%v", s, *q.MaxMagnitude)
+		}
+		if q.MinDepth != nil {
+			s = fmt.Sprintf("%s+AND+depth>=%v", s, *q.MinDepth)
+		}
+		if q.MaxDepth != nil {
+			s = fmt.Sprintf("%s+AND+depth<=%v", s, *q.MaxDepth)
+		}
 		if q.Bbox != "" {
 			s = fmt.Sprintf("%s+AND+BBOX(origin_geom,%v)", s, q.Bbox)
 		}
+		if b := q.Circle.bbox(); b != "" {
+			s = fmt.Sprintf("%s+AND+BBOX(origin_geom,%v)", s, b)
+		}
+		if !q.ModifiedSince.IsZero() {
+			s = fmt.Sprintf("%s+AND+modificationtime>='%s'", s, q.ModifiedSince.UTC().Format("2006-01-02T15:04:05.000"))
+		}
 	}
 
-	return fmt.Sprintf("%s%s", wfsUrl, s)
+	return fmt.Sprintf("%s%s", URL, s)
 }
 
 // result is used for passing variables on the processing pipeline
 type result struct {
+	url      string
 	features []Feature
 	err      error
 }
@@ -182,8 +356,6 @@ func fetcher(done <-chan struct{}, urls <-chan string, c chan<- result) {
 			r.Body.Close()
 		}
 
-		log.Print(url)
-
 		if err == nil && r.StatusCode != 200 {
 			err = errors.New(fmt.Sprintf("Non 200 response code: %d", r.StatusCode))
 		}
@@ -193,7 +365,7 @@ func fetcher(done <-chan struct{}, urls <-chan string, c chan<- result) {
 		}
 
 		select {
-		case c <- result{fs, err}:
+		case c <- result{url, fs, err}:
 		case <-done:
 			return
 		}
@@ -202,7 +374,8 @@ func fetcher(done <-chan struct{}, urls <-chan string, c chan<- result) {
 
 // writeURLs converts the query to WFS search URLs.  The query is
 // chunked into years.  The years overlap on 1 s so there is a small chance
-// of duplicate events being returned.
+// of duplicate events being returned.  EventIDs are chunked into batches of
+// eventIDBatch.
 func (q *Query) writeUrls(done <-chan struct{}) <-chan string {
 	urls := make(chan string)
 	a := *q
@@ -210,6 +383,22 @@ func (q *Query) writeUrls(done <-chan struct{}) <-chan string {
 	go func() {
 		defer close(urls)
 
+		if len(q.EventIDs) > 0 {
+			for i := 0; i < len(q.EventIDs); i += eventIDBatch {
+				j := i + eventIDBatch
+				if j > len(q.EventIDs) {
+					j = len(q.EventIDs)
+				}
+				a.EventIDs = q.EventIDs[i:j]
+				select {
+				case urls <- a.url():
+				case <-done:
+					return
+				}
+			}
+			return
+		}
+
 		// Break the query down into year chunks.
 		if (q.End.Year() - q.Start.Year()) > 0 {
 			a.End = a.Start
@@ -266,11 +455,12 @@ func (q *Query) search() (res map[string]Feature, err error) {
 	quakes := 0
 
 	for r := range c {
+		Progress(progress.Event{Source: "wfs", Kind: progress.Request, URL: r.url})
 		if r.err != nil {
 			return nil, r.err
 		}
 		quakes = quakes + len(r.features)
-		log.Printf("Downloaded %v quakes", quakes)
+		Progress(progress.Event{Source: "wfs", Kind: progress.Quakes, Done: quakes})
 		for _, feature := range r.features {
 			res[feature.Properties.PublicID] = feature
 		}
@@ -19,6 +19,12 @@ func TestURL(t *testing.T) {
 		t.Error("incorrect for eventid, got", q.url())
 	}
 
+	q = Query{EventIDs: []string{"2014p562279", "2014p562280"}, EventID: "2014p562281"}
+
+	if !strings.HasSuffix(q.url(), "cql_filter=publicid+IN+('2014p562279','2014p562280')") {
+		t.Error("incorrect for eventids, got", q.url())
+	}
+
 	q = Query{Start: s, End: e, MinUsedPhaseCount: -999, MinMagnitude: -999.9, Bbox: ""}
 
 	if !strings.HasSuffix(q.url(), "cql_filter=origintime>='2014-01-27T03:06:25'+AND+origintime<='2014-01-27T04:06:25'") {
@@ -54,6 +60,91 @@ func TestURL(t *testing.T) {
 	if !strings.HasSuffix(q.url(), "cql_filter=origintime>='2014-01-27T03:06:25'+AND+origintime<='2014-01-27T04:06:25'+AND+usedphasecount>=60+AND+magnitude>=6.1+AND+BBOX(origin_geom,174,-41,175,-42)") {
 		t.Error("incorrect for min phase count with magnitude and bbox, got", q.url())
 	}
+
+	mag, minDepth, maxDepth := 7.0, 5.0, 40.0
+
+	q = Query{Start: s, End: e, MinUsedPhaseCount: -999, MinMagnitude: -999.9, MaxMagnitude: &mag, MinDepth: &minDepth, MaxDepth: &maxDepth}
+
+	if !strings.HasSuffix(q.url(), "cql_filter=origintime>='2014-01-27T03:06:25'+AND+origintime<='2014-01-27T04:06:25'+AND+magnitude<=7+AND+depth>=5+AND+depth<=40") {
+		t.Error("incorrect for max magnitude and depth, got", q.url())
+	}
+
+	q = Query{Start: s, End: e, MinUsedPhaseCount: -999, MinMagnitude: -999.9, Circle: &Circle{Latitude: -41, Longitude: 174, MaxRadius: 1}}
+
+	if !strings.HasSuffix(q.url(), "+AND+BBOX(origin_geom,172.6749361617219,-42,175.3250638382781,-40)") {
+		t.Error("incorrect for circle, got", q.url())
+	}
+
+	q = Query{Start: s, End: e, MinUsedPhaseCount: -999, MinMagnitude: -999.9, ModifiedSince: e.Add(-30 * time.Minute)}
+
+	if !strings.HasSuffix(q.url(), "+AND+modificationtime>='2014-01-27T03:36:25.000'") {
+		t.Error("incorrect for modified since, got", q.url())
+	}
+}
+
+func TestCircle(t *testing.T) {
+	var c *Circle
+
+	if c.bbox() != "" || !c.contains(-41, 174) {
+		t.Error("nil circle should not restrict the search")
+	}
+
+	c = &Circle{Latitude: -41, Longitude: 174, MinRadius: 0.5, MaxRadius: 1}
+
+	if c.bbox() != "172.6749361617219,-42,175.3250638382781,-40" {
+		t.Error("incorrect bbox, got ", c.bbox())
+	}
+
+	for _, v := range []struct {
+		lat, lon float64
+		in       bool
+	}{
+		{-41, 174, false},
+		{-41.7, 174, true},
+		{-41, 175.1, true},
+		{-42.1, 174, false},
+	} {
+		if c.contains(v.lat, v.lon) != v.in {
+			t.Errorf("contains(%v, %v) expected %v", v.lat, v.lon, v.in)
+		}
+	}
+
+	c = &Circle{Latitude: -85, Longitude: 174, MaxRadius: 10}
+
+	if c.bbox() != "-180,-90,180,-75" {
+		t.Error("incorrect bbox around the pole, got ", c.bbox())
+	}
+
+	c = &Circle{Latitude: -41, Longitude: 179.5, MaxRadius: 1}
+
+	if c.bbox() != "-180,-42,180,-40" {
+		t.Error("incorrect bbox across 180, got ", c.bbox())
+	}
+}
+
+func TestWriteUrls(t *testing.T) {
+	q := Query{EventIDs: make([]string, eventIDBatch*2+1)}
+	for i := range q.EventIDs {
+		q.EventIDs[i] = fmt.Sprintf("2014p%06d", i)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	var urls []string
+	for u := range q.writeUrls(done) {
+		urls = append(urls, u)
+	}
+
+	if len(urls) != 3 {
+		t.Fatal("expected 3 urls for eventids, got ", len(urls))
+	}
+	if !strings.HasSuffix(urls[2], fmt.Sprintf("publicid+IN+('2014p%06d')", eventIDBatch*2)) {
+		t.Error("incorrect last url for eventids, got", urls[2])
+	}
+	if strings.Count(urls[0], ",") != eventIDBatch-1 {
+		t.Error("incorrect number of eventids in first url, got", urls[0])
+	}
 }
 
 func TestGet(t *testing.T) {
@@ -143,3 +234,85 @@ func TestUnmarshal(t *testing.T) {
 		t.Error("e.OriginError expected 0.48022989, got ", e.OriginError)
 	}
 }
+
+func TestMap(t *testing.T) {
+	p := Properties{PublicID: "2014p549333", OriginTime: "2014-07-23T06:04:43.625Z", Depth: 7.34375, Magnitude: 2.6416703, UsedPhaseCount: 23}
+
+	e := p.Map()
+
+	if e["EventID"] != "2014p549333" {
+		t.Error("EventID expected 2014p549333, got ", e["EventID"])
+	}
+	if e["OriginTime"] != "2014-07-23T06:04:43.625Z" {
+		t.Error("OriginTime expected 2014-07-23T06:04:43.625Z, got ", e["OriginTime"])
+	}
+	if e["Depth"] != "7.343750" {
+		t.Error("Depth expected 7.343750, got ", e["Depth"])
+	}
+	if e["Magnitude"] != "2.6416703" {
+		t.Error("Magnitude expected 2.6416703, got ", e["Magnitude"])
+	}
+	if e["UsedPhaseCount"] != "23" {
+		t.Error("UsedPhaseCount expected 23, got ", e["UsedPhaseCount"])
+	}
+	for k := range EventFormat() {
+		if _, ok := e[k]; !ok {
+			t.Error("missing key ", k)
+		}
+	}
+}
+
+func TestSortProperties(t *testing.T) {
+	p := []Properties{
+		{PublicID: "2014p549335", OriginTime: "2014-07-23T06:04:43.7Z"},
+		{PublicID: "2014p549334", OriginTime: "2014-07-23T06:04:43.625Z"},
+		{PublicID: "2014p549333", OriginTime: "2014-07-23T06:04:43.625Z"},
+		{PublicID: "2014p549332", OriginTime: "2014-07-23T06:04:44Z"},
+	}
+
+	sortProperties(p)
+
+	for i, id := range []string{"2014p549333", "2014p549334", "2014p549335", "2014p549332"} {
+		if p[i].PublicID != id {
+			t.Errorf("p[%d] expected %s, got %s", i, id, p[i].PublicID)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	p := []Properties{
+		{PublicID: "2014p549333", OriginTime: "2014-07-23T06:04:43Z", Magnitude: 3},
+		{PublicID: "2014p549334", OriginTime: "2014-07-23T06:04:44Z", Magnitude: 5},
+		{PublicID: "2014p549335", OriginTime: "2014-07-23T06:04:45Z", Magnitude: 4},
+	}
+
+	for _, v := range []struct {
+		q   Query
+		ids string
+	}{
+		{Query{}, "2014p549333,2014p549334,2014p549335"},
+		{Query{OrderBy: "time"}, "2014p549335,2014p549334,2014p549333"},
+		{Query{OrderBy: "magnitude"}, "2014p549334,2014p549335,2014p549333"},
+		{Query{OrderBy: "magnitude-asc"}, "2014p549333,2014p549335,2014p549334"},
+		{Query{OrderBy: "time", Limit: 2}, "2014p549335,2014p549334"},
+		{Query{OrderBy: "time", Offset: 1, Limit: 1}, "2014p549334"},
+		{Query{Offset: 3}, ""},
+	} {
+		o, err := v.q.Order(append([]Properties{}, p...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, e := range o {
+			ids = append(ids, e.PublicID)
+		}
+		if strings.Join(ids, ",") != v.ids {
+			t.Errorf("%+v expected %s, got %s", v.q, v.ids, strings.Join(ids, ","))
+		}
+	}
+
+	q := Query{OrderBy: "depth"}
+	if _, err := q.Order(p); err == nil {
+		t.Error("expected an error for OrderBy depth")
+	}
+}